@@ -0,0 +1,206 @@
+package smart
+
+import (
+	"bytes"
+	go_flag "flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = go_flag.Bool("update", false, "rewrite the .golden files of testdata/golden")
+
+// goldenStack matches the call stack lines printed after a diagnostic, they
+// change with every edit of the sources.
+var goldenStack = regexp.MustCompile(`(?m)^\S+\.go:\d+:info: .*\n`)
+
+// TestGolden runs each testdata/golden/**/*.smart in a universe of its own
+// and compares the captured diagnostics, defs and results against the
+// .golden file next to it, `go test -update` rewrites them.
+func TestGolden(t *testing.T) {
+	var root = filepath.Join("testdata", "golden")
+	var cases []string
+	err := filepath.WalkDir(root, func(s string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() {
+			if s != root && strings.HasPrefix(d.Name(), ".") { return filepath.SkipDir }
+		} else if strings.HasSuffix(s, ".smart") {
+			cases = append(cases, s)
+		}
+		return nil
+	})
+	if err != nil { t.Fatal(err) }
+
+	for _, s := range cases {
+		var name = filepath.ToSlash(s)
+		t.Run(strings.TrimSuffix(strings.TrimPrefix(name, "testdata/golden/"), ".smart"), func(t *testing.T) {
+			var got = goldenRun(t, s, name)
+			var filename = strings.TrimSuffix(s, ".smart") + ".golden"
+			if *update {
+				if b, err := os.ReadFile(filename); err == nil && string(b) == got {
+					return
+				} else if err = os.WriteFile(filename, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Logf("updated %s", filename)
+				return
+			}
+			if b, err := os.ReadFile(filename); err != nil {
+				t.Fatal(err)
+			} else if want := string(b); want != got {
+				t.Errorf("%s\n%s", name, goldenDiff(want, got))
+			}
+		})
+	}
+}
+
+// TestGoldenAgain runs a case twice, the second universe must not see the
+// declarations of the first one (e.g. $(matcher)).
+func TestGoldenAgain(t *testing.T) {
+	var s = filepath.Join("testdata", "golden", "matcher", "matcher.smart")
+	var name = filepath.ToSlash(s)
+	if want, got := goldenRun(t, s, name), goldenRun(t, s, name); want != got {
+		t.Errorf("%s\n%s", name, goldenDiff(want, got))
+	}
+}
+
+// goldenRun loads a copy of the source (and of the other files next to it,
+// e.g. an included Makefile) as the main project of a fresh universe with
+// a clear environment and returns everything it printed (defs, rules and
+// results), temporary paths are replaced by the name of the source to keep
+// the output stable.
+func goldenRun(t *testing.T, filename, name string) string {
+	var out bytes.Buffer
+	var dir = t.TempDir()
+
+	// Clear the environment, e.g. CC of a Makefile is taken from it.
+	for _, s := range os.Environ() {
+		switch name, _, _ := strings.Cut(s, "="); name {
+		case "", "PATH", "HOME", "TMPDIR":
+		default:
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+
+	var source = filepath.Join(dir, symMainFileName.String())
+	if b, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if err = os.WriteFile(source, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ents, err := os.ReadDir(filepath.Dir(filename)); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, e := range ents {
+			var s = e.Name()
+			if e.IsDir() || strings.HasSuffix(s, ".smart") || strings.HasSuffix(s, ".golden") { continue }
+			if b, err := os.ReadFile(filepath.Join(filepath.Dir(filename), s)); err != nil {
+				t.Fatal(err)
+			} else if err = os.WriteFile(filepath.Join(dir, s), b, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var h hooks
+	h.debug = func(c Context, s string, _ []Value) { fmt.Fprintf(&out, "%v: debug: %s\n", _position(c), s) }
+	h.error = func(c Context, s string, _ []Value) { fmt.Fprintf(&out, "%v: error: %s\n", _position(c), s) }
+	h.assert = func(c Context, v Value, y bool) bool {
+		if !y { fmt.Fprintf(&out, "%v: assert: %v\n", _position(c), v) }
+		return true
+	}
+
+	// Capture the diagnostics and outputs of the case.
+	defer redirect(&out, &out)()
+
+	var x = new_universe(h, workdir_sym(intern(dir)), []string{})
+	func() {
+		defer func() {
+			var e = recover()
+			x.flush(x)
+			switch t := e.(type) {
+			case nil:
+			case unwind_errors: fmt.Fprintf(&out, "unwound: %d errors\n", t.int)
+			case error: fmt.Fprintf(&out, "panic: %s\n", t.Error())
+			default: fmt.Fprintf(&out, "panic: %v\n", t)
+			}
+		}()
+
+		if x.load(main_ctx{x}); x.flush(x) > 0 {
+			return
+		}
+
+		if m := x.globe.main; m != nil {
+			var c = closure_with(main_ctx{x}, m.scope)
+			var defs = make(map[string]*def)
+			var names []string
+			for sym, o := range m.scope.copyElems() {
+				if d, ok := o.(*def); ok {
+					defs[sym.String()] = d
+					names = append(names, sym.String())
+				}
+			}
+			sort.Strings(names)
+			for _, s := range names {
+				var v string
+				if d := defs[s]; d.value != nil {
+					v = strings.TrimSpace(__string(c, d.value))
+				}
+				fmt.Fprintf(&out, "def %s = %s\n", s, v)
+			}
+
+			var seen = make(map[*rule]bool)
+			var rules []*rule
+			m.entries.each(func(a any) {
+				if r, ok := a.(*rule); ok && !seen[r] {
+					seen[r] = true
+					rules = append(rules, r)
+				}
+			})
+			for _, r := range append(rules, m.patterns...) {
+				for _, prog := range r.program {
+					var a []string
+					for _, v := range append(prog.depends, prog.ordered...) { a = append(a, v.String()) }
+					fmt.Fprintf(&out, "rule %s: %s\n", __string(c, r.target), strings.Join(a, " "))
+					for _, v := range prog.recipes { fmt.Fprintf(&out, "\t%s\n", v) }
+				}
+			}
+		}
+
+		var result = x.run(main_ctx{x})
+		x.flush(x)
+		for _, v := range result {
+			if v == nil {
+				fmt.Fprintf(&out, "result: <nil>\n")
+			} else {
+				fmt.Fprintf(&out, "result: %s\n", strings.TrimSpace(__string(x, v)))
+			}
+		}
+	}()
+
+	var s = goldenStack.ReplaceAllString(out.String(), "")
+	s = strings.ReplaceAll(s, source, name)
+	return strings.ReplaceAll(s, dir, filepath.Dir(name))
+}
+
+// goldenDiff lists the lines that differ between want and got.
+func goldenDiff(want, got string) string {
+	var a, b = strings.Split(want, "\n"), strings.Split(got, "\n")
+	var sb strings.Builder
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y string
+		if i < len(a) { x = a[i] }
+		if i < len(b) { y = b[i] }
+		if x == y { continue }
+		if i < len(a) { fmt.Fprintf(&sb, "    %d: - %s\n", i+1, x) }
+		if i < len(b) { fmt.Fprintf(&sb, "    %d: + %s\n", i+1, y) }
+	}
+	return sb.String()
+}
@@ -37,14 +37,18 @@
 package smart
 
 import (
+    "archive/tar"
+    "archive/zip"
     "bufio"
+    "compress/bzip2"
+    "compress/gzip"
     "sync"
     "os/exec"
 	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/base64"
-	// enc_bin "encoding/binary"
+	enc_bin "encoding/binary"
     enc_json "encoding/json"
     enc_xml "encoding/xml"
     // enc_csv "encoding/csv"
@@ -123,6 +127,8 @@ const (
     maxRetries = 1
 	maxCallRecursion  = 32 //64
 
+    fetchTimeout = 30 * time_pkg.Minute // see fetch
+
 	// Threshold for preferring for-loop-array then using a map-lookup.
 	mapThreshold = 16
 )
@@ -132,6 +138,7 @@ var (
 	// Reusing hashers prevents constant heap escapes during massive build graphs.
 	sha256Pool = sync.Pool{ New: func() any { return sha256.New() } }
     udots = []byte("…")
+    fetchClient = &http.Client{ Timeout: fetchTimeout }
 )
 
 // compactbuilds provides zero-allocation stream compression and lazy separator
@@ -357,7 +364,7 @@ const (
 	SymFlt uint8 = 4 // Idx points to `vocab.numbers` as float64
 	SymSeq uint8 = 5 // Idx points to `vocab.sequences`
 	SymEph uint8 = 6 // Idx points to `vocab.ephemeral`
-	SymBlb uint8 = 7 // Idx points to context blob registry
+	SymBlb uint8 = 7 // ID points to the VM-local blob registry, Idx and Rank to the face (see symstr.bindBlob)
 )
 
 // Define the bit-shift offsets as single sources of truth
@@ -664,6 +671,7 @@ const (
 	symBug
 	symDev
 	symSilent
+	symPinned
 
 	symSrc // src
 	symBin // bin
@@ -696,6 +704,23 @@ const (
 	symTarname
 	symHave
 
+	symScheme
+	symUsername
+	symPassword
+	symHost
+	symPort
+	symQuery
+	symFragment
+	symFetch
+	symDownload
+	symArchive
+	symSkip
+	symMatcher
+	symLanginfo
+	symPrecious
+	symIntermediate
+	symSecondary
+
 	sym_fPIC
 	sym_fcxx
 	sym_fmodules
@@ -1070,12 +1095,13 @@ var coreSymRaws = []string{
 	"plugin", "plugins", "remnant", "variant", "tag", "target", "triple", "temp", "tmp", "ts",
 
 	"app", "ahead", "shared", "static", "inlines", "hidden", "work", "workout", "workspace", "modified",
-	"test", "bugs", "bug", "dev", "silent",
+	"test", "bugs", "bug", "dev", "silent", "pinned",
 
 	"src", "bin", "log", "exe", "dyn", "llc", "cpp", "cxx",
 	"c", "cc", "o", "O", "Os", "m", "mm", "s", "S", "so", "h", "hh",
 
 	"package", "version", "vendor", "url", "bugreport", "tar", "tarname", "have",
+	"scheme", "username", "password", "host", "port", "query", "fragment", "fetch", "download", "archive", "skip", "matcher", "langinfo", "precious", "intermediate", "secondary",
 	"fPIC", "fcxx", "fmodules", "fvisibility",
 
 	"M", "MM", "MG", "MD", "MV", "MP", "INFO", "MESSAGE", "MSG", "TARGET", "VALUE", "VAL", "LANGUAGE", "LANG",
@@ -1125,6 +1151,14 @@ func (s Symbol) Idx() int32   { return int32((s >> 28) & 0xFFFFFFF) }
 func (s Symbol) Flags() uint8 { return uint8(s >> 56) }
 func (s Symbol) Kind() uint8  { return s.Flags() & 0x07 }
 func (s Symbol) Rank() int    { return int((s.Flags() >> 3) & 0x0F) }
+func (s Symbol) isBlob() bool { return s.Kind() == SymBlb } // see symstr.bindBlob
+
+// unblob returns a symbol reading the content of a blob's face (the Idx and
+// the kind kept in the Rank bits, see symstr.bindBlob), or the symbol itself.
+func (s Symbol) unblob() Symbol {
+	if s.Kind() != SymBlb { return s }
+	return packSymbol(s.id(), s.Idx(), uint8(s.Rank()), 0)
+}
 
 // add mathematically increments both the ID and Idx planes of a packed Symbol.
 // Use this instead of raw integer addition to maintain bit-struct integrity
@@ -1161,7 +1195,7 @@ type vocabulary struct {
 	numbers []uint64 // Side-table for numbers!
 
 	// 5. Ephemeral Domain
-	ephmut    sync.Mutex // Mutex is usually enough here (no maps to read concurrently)
+	ephmut    sync.RWMutex // readers (views of temp names) don't contend, see symstr.blobs for VM objects
 	ephemeral []string // Side-table for ephemeral strings (for hash/timestamp etc.)!
 	freeeph   []Symbol // free pool for recycled SymEph symbols
 }
@@ -1173,7 +1207,7 @@ func (v *vocabulary) Lock() {
 	v.strmut.Lock()
 	v.seqmut.Lock()
 	v.nummut.Lock()
-	v.ephmut.Lock() // ephmut is a standard Mutex
+	v.ephmut.Lock()
 }
 
 // Unlock releases all domain locks in exact reverse order (LIFO).
@@ -1189,12 +1223,12 @@ func (v *vocabulary) RLock() {
 	v.strmut.RLock()
 	v.seqmut.RLock()
 	v.nummut.RLock()
-	v.ephmut.Lock() // Ephemeral only has Mutex, so we exclusively lock it
+	v.ephmut.RLock()
 }
 
 // RUnlock releases all domain read-locks in exact reverse order (LIFO).
 func (v *vocabulary) RUnlock() {
-	v.ephmut.Unlock()
+	v.ephmut.RUnlock()
 	v.nummut.RUnlock()
 	v.seqmut.RUnlock()
 	v.strmut.RUnlock()
@@ -1216,6 +1250,8 @@ func (sym Symbol) unsafe_len() int {
 		return len(vocab.strings[sym.Idx()])
 	case SymEph:
 		return len(vocab.ephemeral[sym.Idx()])
+	case SymBlb:
+		return sym.unblob().unsafe_len()
 	case SymInt:
 		var buf [24]byte
 		return len(strconv.AppendInt(buf[:0], int64(vocab.numbers[sym.Idx()]), 10))
@@ -1244,10 +1280,12 @@ func (sym Symbol) len() int {
 		vocab.strmut.RUnlock()
 		return l
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		l := len(vocab.ephemeral[sym.Idx()])
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 		return l
+	case SymBlb:
+		return sym.unblob().len()
 	case SymInt, SymFlt:
 		vocab.nummut.RLock()
 		num := vocab.numbers[sym.Idx()]
@@ -1284,6 +1322,8 @@ func (sym Symbol) unsafe_view(buf *[64]byte) string {
 	case SymEph:
 		s := vocab.ephemeral[sym.Idx()]
 		return s
+	case SymBlb:
+		return sym.unblob().unsafe_view(buf)
 	case SymPct, SymInl:
 		u := uint32(sym.Idx())
 		ln := int((u >> 24) & 0x3)
@@ -1321,6 +1361,8 @@ func (sym Symbol) unsafe_view_append(buf []byte) []byte {
 	case SymEph:
 		buf = append(buf, vocab.ephemeral[sym.Idx()]...)
 		return buf
+	case SymBlb:
+		return sym.unblob().unsafe_view_append(buf)
 	case SymInt:
 		n := vocab.numbers[sym.Idx()]
 		return strconv.AppendInt(buf, int64(n), 10)
@@ -1348,10 +1390,12 @@ func (sym Symbol) view(buf *[64]byte) string {
 		vocab.strmut.RUnlock()
 		return s
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		s := vocab.ephemeral[sym.Idx()]
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 		return s
+	case SymBlb:
+		return sym.unblob().view(buf)
 	case SymPct, SymInl:
 		u := uint32(sym.Idx())
 		ln := int((u >> 24) & 0x3)
@@ -1394,10 +1438,12 @@ func (sym Symbol) view_append(buf []byte) []byte {
 		vocab.strmut.RUnlock()
 		return buf
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		buf = append(buf, vocab.ephemeral[sym.Idx()]...)
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 		return buf
+	case SymBlb:
+		return sym.unblob().view_append(buf)
 	case SymInt:
 		vocab.nummut.RLock()
 		n := vocab.numbers[sym.Idx()]
@@ -1423,6 +1469,8 @@ func (sym Symbol) view_append(buf []byte) []byte {
 // and evaluates them. It guarantees zero allocations for both atomic leaves
 // and sequences up to 512 bytes.
 func views[T any](f func(string, string) T, s1, s2 Symbol) T {
+	s1, s2 = s1.unblob(), s2.unblob() // blobs are read as their faces
+
 	// Fast-path: Both are atomic leaves
 	if s1.Kind() != SymSeq && s2.Kind() != SymSeq {
 		var b1, b2 [64]byte
@@ -1545,9 +1593,9 @@ func (sym Symbol) equal_string(s string) bool {
 		return res
 
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		res := vocab.ephemeral[idx] == s
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 		return res
 
 	case SymInt:
@@ -1598,9 +1646,9 @@ func (sym Symbol) equal_bytes(b []byte) bool {
 		vocab.strmut.RUnlock()
 
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		str = vocab.ephemeral[idx]
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 
 	case SymInt:
 		vocab.nummut.RLock()
@@ -1667,6 +1715,7 @@ func (s Symbol) split_last(sep Symbol) (Symbol, Symbol, bool) {
 func (sym Symbol) build(b *compactbuilds) {
 	if sym == 0 || sym.id() >= vocab.symcount.Load() { return }
 
+	sym = sym.unblob() // blobs are built as their faces
 	if sym.Kind() == SymSeq {
 		vocab.seqmut.RLock()
 		seq := vocab.sequences[sym.Idx()]
@@ -1683,6 +1732,7 @@ func (sym Symbol) build(b *compactbuilds) {
 func (sym Symbol) unsafe_build(b *compactbuilds) {
 	if sym == 0 || sym.id() >= vocab.symcount.Load() { return }
 
+	sym = sym.unblob() // blobs are built as their faces
 	if sym.Kind() == SymSeq {
 		seq := vocab.sequences[sym.Idx()]
 		for _, p := range seq { p.unsafe_build(b) }
@@ -1720,10 +1770,12 @@ func (sym Symbol) String() string {
 		vocab.strmut.RUnlock()
 		return s
 	case SymEph:
-		vocab.ephmut.Lock()
+		vocab.ephmut.RLock()
 		s := vocab.ephemeral[sym.Idx()]
-		vocab.ephmut.Unlock()
+		vocab.ephmut.RUnlock()
 		return s
+	case SymBlb:
+		return sym.unblob().String()
 	}
 
 	// Slow-path: Allocate exactly once for numbers, inline bytes, and sequences!
@@ -1827,7 +1879,7 @@ func init() {
 		h := hashStr(seq)
 		id := _id_pct_end + i
 		sym := unsafe_make_symbol(seq, uint32(id))
-		vocab.seqsyms[h] = append(vocab.seqsyms[h], sym)
+		vocab.strsyms[h] = append(vocab.strsyms[h], sym) // intern() looks up by string hash
 		if sym.Kind() == SymSeq {
 			h := hashSeq(vocab.sequences[sym.Idx()])
 			vocab.seqsyms[h] = append(vocab.seqsyms[h], sym)
@@ -1860,12 +1912,22 @@ func init() {
 	}
 
 	if info, ok := langInfos["c"]; ok {
-		langInfos["c++"] = info
 		langInfos["clang"] = info
-		langInfos["objc"] = info
+	}
+
+	if info, ok := langInfos["c++"]; ok {
+		langInfos["cpp"] = info
+		langInfos["cxx"] = info
+	}
+
+	if info, ok := langInfos["objc"]; ok {
 		langInfos["objc++"] = info
 	}
 
+	if info, ok := langInfos["glsl"]; ok {
+		langInfos["hlsl"] = info
+	}
+
 	if info, ok := langInfos["i"]; ok {
 		langInfos["include"] = info
 		langInfos["TableGen"] = info
@@ -3050,6 +3112,89 @@ const (
 	opSelect                           // Executes a select/match branch evaluation
 )
 
+var evalopNames = [...]string{
+	opEnd:               "End",
+	opUnwind:            "Unwind",
+	opDebug:             "Debug",
+	opRestoreContext:    "RestoreContext",
+	opSwap:              "Swap",
+	opCons:              "Cons",
+	opCompact:           "Compact",
+	opValidate:          "Validate",
+	opCompactValid:      "CompactValid",
+	opRet:               "Ret",
+	opRetRev:            "RetRev",
+	opRetPack:           "RetPack",
+	opRetPackRev:        "RetPackRev",
+	opRetMatch:          "RetMatch",
+	opRetMatchRev:       "RetMatchRev",
+	opEvokeRet:          "EvokeRet",
+	opRegexMatch:        "RegexMatch",
+	opRegexMatchRev:     "RegexMatchRev",
+	opRegexCon:          "RegexCon",
+	opMatchLiteral:      "MatchLiteral",
+	opMatchLiteralRev:   "MatchLiteralRev",
+	opGlobQues:          "GlobQues",
+	opGlobQuesRev:       "GlobQuesRev",
+	opGlobAsterisk:      "GlobAsterisk",
+	opGlobAsteriskRev:   "GlobAsteriskRev",
+	opGlobAstGreed:      "GlobAstGreed",
+	opGlobAstGreedRev:   "GlobAstGreedRev",
+	opTryGlobGreed:      "TryGlobGreed",
+	opTryGlobGreedRev:   "TryGlobGreedRev",
+	opGlobAstCross:      "GlobAstCross",
+	opGlobAstCrossRev:   "GlobAstCrossRev",
+	opGlobRange:         "GlobRange",
+	opGlobRangeRev:      "GlobRangeRev",
+	opConseqAsterisk:    "ConseqAsterisk",
+	opConseqAsteriskRev: "ConseqAsteriskRev",
+	opConseqAstGreed:    "ConseqAstGreed",
+	opConseqAstGreedRev: "ConseqAstGreedRev",
+	opConseqAstCross:    "ConseqAstCross",
+	opConseqAstCrossRev: "ConseqAstCrossRev",
+	opEval:              "Eval",
+	opUnroll:            "Unroll",
+	opUnrollRev:         "UnrollRev",
+	opUnrollPack:        "UnrollPack",
+	opUnrollPackRev:     "UnrollPackRev",
+	opUnrollMatch:       "UnrollMatch",
+	opUnrollMatchRev:    "UnrollMatchRev",
+	opMerge:             "Merge",
+	opCompound:          "Compound",
+	opQualword:          "Qualword",
+	opGlobbrace:         "Globbrace",
+	opPath:              "Path",
+	opPathStr:           "PathStr",
+	opEase:              "Ease",
+	opEvoke:             "Evoke",
+	opTraverse:          "Traverse",
+	opResolve:           "Resolve",
+	opExpandArgs:        "ExpandArgs",
+	opExpandArgsRev:     "ExpandArgsRev",
+	opExpand:            "Expand",
+	opExpandRev:         "ExpandRev",
+	opReduce:            "Reduce",
+	opReduceRev:         "ReduceRev",
+	opUnloc:             "Unloc",
+	opLoc:               "Loc",
+	opLocPack:           "LocPack",
+	opNegate:            "Negate",
+	opFlag:              "Flag",
+	opPair:              "Pair",
+	opCompose:           "Compose",
+	opConjunct:          "Conjunct",
+	opDisjunct:          "Disjunct",
+	opFullname:          "Fullname",
+	opRule:              "Rule",
+	opModify:            "Modify",
+	opSelect:            "Select",
+}
+
+func (op evalop) String() string {
+	if int(op) < len(evalopNames) && evalopNames[op] != "" { return evalopNames[op] }
+	return fmt.Sprintf("evalop(%d)", op)
+}
+
 const (
 	clsMatcher = 1 << iota
 	clsPacker
@@ -3186,6 +3331,20 @@ type symstr struct {
 	backtracks  []backtrack // The VM State Machine Rewind Stack
 	err         error       // VM fatal error state
 	class       int         // Bitmask tracking AST structural composition (volatile)
+
+	// 5. VM-Local Blob Registry (lock-free, dropped when the VM halts)
+	blobs       []vmblob    // Objects carried on the tape as SymBlb symbols
+	matching    evalop      // opRet/opRetRev while a matcher reads the tape (see match and unblobHead)
+	unblobbing  bool        // Unrolling a blob back into plain symbols (see unblobHead)
+
+	debugger    *vmdebugger // The vmdebugger of the universe (see vmdebug)
+}
+
+// vmblob is an object carried as a SymBlb symbol, `face` is the symbol the
+// matcher reads in place of the object (e.g. the name of a *file).
+type vmblob struct {
+	obj  any
+	face Symbol
 }
 
 func (s *symstr) do(ctx Context, op any) any { // Optional!
@@ -3340,10 +3499,11 @@ func (s *symstr) op_match_literal(l int) {
 
 	target := s.tie.syms[0]
 
-	if lit.Symbol == target.Symbol {
+	if lit.Symbol == target.Symbol || lit.Symbol == s.tie.face(target.Symbol) {
 		ret(s.tie.pop_head().Symbol)
 		return
 	}
+	target.Symbol = s.tie.face(target.Symbol) // not the blob itself, compare its face
 
 	const bidirectional_fallback_ret_literal = false
 
@@ -3588,10 +3748,11 @@ func (s *symstr) op_match_literal_rev(l int) {
 
 	target := s.tie.syms[0]
 
-	if lit.Symbol == target.Symbol {
+	if lit.Symbol == target.Symbol || lit.Symbol == s.tie.face(target.Symbol) {
 		ret(s.tie.pop_head().Symbol)
 		return
 	}
+	target.Symbol = s.tie.face(target.Symbol) // not the blob itself, compare its face
 
 	const bidirectional_fallback_ret_literal = false
 
@@ -4185,7 +4346,7 @@ func (s *symstr) op_glob_seg(l int) {
 	}
 
 	// Fallback
-	if len(stem) > 0 {
+	if len(stem) > 0 && nextLit.Symbol == symEmpty {
 		s.nfa_emit(stem, origStemsCount, origStemsLen)
 		if s.tie != nil { s.tie.syms = origTieSyms }
 		return
@@ -4382,6 +4543,13 @@ func (s *symstr) op_glob_greed(l int) {
 		stem = append(stem, s.tie.syms...)
 		s.tie.syms = nil
 
+		// Greedy up to the last literal of the whole tape (e.g. %.c on a.b.c).
+		for nextLit.Symbol != symEmpty && s.tie.ensured_syms() {
+			stem = append(stem, s.tie.syms...)
+			s.tie.syms = nil
+		}
+		if s.tie.err == io.EOF { s.tie.err = nil }
+
 		if nextLit.Symbol == symEmpty {
 			s.ops = append(s.ops, opConseqAstGreed)
 			s.operands = append(s.operands, nextLit, stem)
@@ -6344,9 +6512,16 @@ func (s *symstr) op_unroll_match(l int) {
 			}
 			break
 		}
-		if suffix != nil && !isEmpty(suffix) { retVal(suffix) }
+		// Unrolled (not matched as a whole) for the qualwords, e.g. %.c.
+		if suffix != nil && !isEmpty(suffix) {
+			s.ops = append(s.ops, opUnrollMatch)
+			s.operands = append(s.operands, suffix)
+		}
 		s.ops = append(s.ops, opGlobAstGreed)
-		if v.Prefix != nil && !isEmpty(v.Prefix) { retVal(v.Prefix) }
+		if v.Prefix != nil && !isEmpty(v.Prefix) {
+			s.ops = append(s.ops, opUnrollMatch)
+			s.operands = append(s.operands, v.Prefix)
+		}
 
 	case *delegate, *closure:
 		var isClosure bool
@@ -6926,6 +7101,12 @@ func (s *symstr) op_ret_value(l int, t Value) {
 		s.operands = append(s.operands, val)
 	}
 
+	// Files and closures are carried as blobs (see bindBlob), unblobHead
+	// unrolls them again when the matcher has to see their segments.
+	retFile := func(pos Pos, v Value, name Symbol) {
+		if s.unblobbing && name.Kind() == SymSeq { retSym(pos, name) } else { retSym(pos, s.bindBlob(v, name)) }
+	}
+
 	switch v := t.(type) {
 	case *loc:          retVal(v.Value)
 	case *word:         retSym(v.pos, v.s)
@@ -6941,8 +7122,8 @@ func (s *symstr) op_ret_value(l int, t Value) {
 	case *def:          retSym(v.pos, v.name)
 	case *auto:         retSym(v.pos, v.name)
 	case *builtin:      retSym(v.pos, v.name)
-	case *file:         retSym(v.pos, v.name)
-	case fullfile:      retSym(v.pos, v.name)
+	case *file:         retFile(v.pos, v, v.name)
+	case fullfile:      retFile(v.pos, v, v.name)
 	case *regexpat:     retSym(v.Pos(), __symbol(s.Context, v))
 	case *globmeta:     retSym(v.pos, v.sym)
 	case *globrange:
@@ -6960,6 +7141,11 @@ func (s *symstr) op_ret_value(l int, t Value) {
 		retSym(v.Pos(), symDash)
 
 	case *delegate, *closure:
+		if !s.unblobbing {
+			retSym(v.Pos(), s.bindBlob(v, intern(v.String())))
+			break
+		}
+
 		var d *delegate
 		var sigil, left, right Symbol
 		switch tx := v.(type) {
@@ -7054,6 +7240,12 @@ func (s *symstr) op_ret_value_rev(l int, t Value) {
 		s.operands = append(s.operands, val)
 	}
 
+	// Files and closures are carried as blobs (see bindBlob), unblobHead
+	// unrolls them again when the matcher has to see their segments.
+	retFile := func(pos Pos, v Value, name Symbol) {
+		if s.unblobbing && name.Kind() == SymSeq { retSym(pos, name) } else { retSym(pos, s.bindBlob(v, name)) }
+	}
+
 	switch v := t.(type) {
 	case *loc:          retVal(v.Value)
 	case *word:         retSym(v.pos, v.s)
@@ -7069,8 +7261,8 @@ func (s *symstr) op_ret_value_rev(l int, t Value) {
 	case *def:          retSym(v.pos, v.name)
 	case *auto:         retSym(v.pos, v.name)
 	case *builtin:      retSym(v.pos, v.name)
-	case *file:         retSym(v.pos, v.name)
-	case fullfile:      retSym(v.pos, v.name)
+	case *file:         retFile(v.pos, v, v.name)
+	case fullfile:      retFile(v.pos, v, v.name)
 	case *regexpat:     retSym(v.Pos(), __symbol(s.Context, v))
 	case *globmeta:     retSym(v.pos, v.sym)
 	case *globrange:
@@ -7088,6 +7280,11 @@ func (s *symstr) op_ret_value_rev(l int, t Value) {
 		retVal(v.Value)
 
 	case *delegate, *closure:
+		if !s.unblobbing {
+			retSym(v.Pos(), s.bindBlob(v, intern(v.String())))
+			break
+		}
+
 		var d *delegate
 		var sigil, left, right Symbol
 		switch tx := v.(type) {
@@ -7433,6 +7630,8 @@ func (s *symstr) step() {
 	s.ops = s.ops[:len(s.ops)-1]
 	s.opsDone++
 
+	if vmdebugging.Load() && s.vmdebug().trace { s.debugStep(op) }
+
 _op_switch_:
 	switch l, rl := len(s.operands), len(s.results); op {
 	case opDebug:
@@ -8325,6 +8524,130 @@ _op_switch_:
 	}
 }
 
+// vmdebugger is the state of -debug-vm (disassemble and trace every VM
+// step) and -debug-vm-step (interactive stepping) of a universe, see disasm
+// and debugStep.
+type vmdebugger struct {
+	trace, step bool
+	cont  *symstr       // continue without stepping until this VM halts
+	stdin *bufio.Reader // commands of the stepper, reading universe.stdin
+}
+
+// vmdebugging is set once a universe enables its vmdebugger, VMs don't look
+// up their universe before.
+var vmdebugging atomic.Bool
+
+// vmdebug returns the vmdebugger of the universe of the VM.
+func (s *symstr) vmdebug() *vmdebugger {
+	if s.debugger == nil {
+		if u := _universe(s.Context); u != nil {
+			s.debugger = &u.vmdebug
+		} else {
+			s.debugger = &vmdebugger{}
+		}
+	}
+	return s.debugger
+}
+
+func vmoperand(a any) string {
+	switch t := a.(type) {
+	case posym:
+		if t.isBlob() { return fmt.Sprintf("#%q", t.Symbol.String()) } // blob, see bindBlob
+		return fmt.Sprintf("%q", t.Symbol.String())
+	case Value: return fmt.Sprintf("%T %v", t, t)
+	case []Value: return fmt.Sprintf("%v (%d values)", t, len(t))
+	case nil: return "<nil>"
+	default: return fmt.Sprintf("%T %v", t, t)
+	}
+}
+
+func vmtape(syms []posym, str string) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, ps := range syms {
+		if i > 0 { b.WriteString(" ") }
+		if ps.isBlob() { b.WriteString("#") } // blob, see bindBlob
+		fmt.Fprintf(&b, "%q", ps.Symbol.String())
+	}
+	b.WriteString("]")
+	if str != "" { fmt.Fprintf(&b, " str=%q", str) }
+	return b.String()
+}
+
+// disasm dumps the compiled op stream (next op first) and the operands.
+func (s *symstr) disasm(what string, a ...Value) {
+	var b strings.Builder // formatting eagerly (see debugStep)
+	fmt.Fprintf(&b, "┌ vm %p %s %v\n", s, what, a)
+	for i := len(s.ops) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "│ %4d %v\n", len(s.ops)-1-i, s.ops[i])
+	}
+	for i := len(s.operands) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "│      $%d %s\n", len(s.operands)-1-i, vmoperand(s.operands[i]))
+	}
+	if s.tie != nil { fmt.Fprintf(&b, "│ tie  %s\n", vmtape(s.tie.syms, s.tie.str)) }
+	prompt(s, "%s", b.String())
+}
+
+// debugStep prints the VM state before executing op, and waits for a
+// command if stepping interactively.
+func (s *symstr) debugStep(op evalop) {
+	var operand string
+	if l := len(s.operands); l > 0 { operand = vmoperand(s.operands[l-1]) }
+	// NOTE: formatting eagerly, the VM state is changed before flushing
+	var b strings.Builder
+	fmt.Fprintf(&b, "│ %p #%d %v $0=%s\n", s, s.opsDone, op, operand)
+	fmt.Fprintf(&b, "│   ops=%v tape=%s", s.ops, vmtape(s.syms, s.str))
+	if s.tie != nil { fmt.Fprintf(&b, " tie=%s", vmtape(s.tie.syms, s.tie.str)) }
+	b.WriteString("\n")
+	if len(s.stems) > 0 || len(s.backtracks) > 0 {
+		fmt.Fprintf(&b, "│   stems=%s backtracks=%d\n", s.debugStems(), len(s.backtracks))
+	}
+	prompt(s, "%s", b.String())
+
+	var d = s.vmdebug()
+	if !d.step || d.cont == s { return }
+	if d.stdin == nil {
+		var r io.Reader = os.Stdin
+		if u := _universe(s.Context); u != nil && u.stdin != nil { r = u.stdin }
+		d.stdin = bufio.NewReader(r)
+	}
+	for {
+		prompt(s, "vm> ")
+		flush(s) // show the state before waiting
+		line, err := d.stdin.ReadString('\n')
+		if err != nil { d.step = false; return } // stdin closed
+		switch strings.TrimSpace(line) {
+		case "", "s", "step": return
+		case "c", "continue": d.cont = s; return
+		case "q", "quit": d.step = false; return
+		case "t", "trace-off": d.trace, d.step = false, false; return
+		case "d", "disasm": s.disasm("at")
+		case "b", "backtracks":
+			for i := len(s.backtracks) - 1; i >= 0; i-- {
+				bt := &s.backtracks[i]
+				prompt(s, "%s", fmt.Sprintf("│ bt%d kind=%09b alt=%v,%v stem=%v val=%s\n", i, bt.kind,
+					bt.altOp1, bt.altOp2, bt.altStem.start, vmoperand(bt.altVal)))
+			}
+		default:
+			prompt(s, "s(tep), c(ontinue) this VM, d(isasm), b(acktracks), q(uit) stepping, t(race-off)\n")
+		}
+	}
+}
+
+func (s *symstr) debugStems() string {
+	var a []string
+	for _, c := range s.stems {
+		var t string
+		for _, ps := range c.syms { t += ps.Symbol.String() }
+		if c.name.Symbol != symEmpty {
+			a = append(a, fmt.Sprintf("%s=%q[%d:%d]", c.name.Symbol, t, c.start, c.end))
+		} else {
+			a = append(a, fmt.Sprintf("%q[%d:%d]", t, c.start, c.end))
+		}
+	}
+	return "[" + strings.Join(a, " ") + "]"
+}
+
 // checkpoint acts as a zero-allocation builder for backtrack instructions.
 func (s *symstr) checkpoint(kind uint32) backtrack {
 	bt := backtrack{
@@ -8405,7 +8728,7 @@ func (s *symstr) unwind(bt *backtrack) {
 		if (bt.kind & undoCtx) != 0 { s.Context = bt.own.context }
 		if (bt.kind & undoHead) != 0 { s.vmhead = bt.own.vmhead }
 		if (bt.kind & undoPack) != 0 { s.vmpack = bt.own.vmpack }
-		if (bt.kind & undoStack) != 0 { if bt.own.vmpack != nil { s.vmpack = bt.own.vmpack.clone() } else { s.vmpack = nil } }
+		if (bt.kind & undoStack) != 0 { s.vmstack.restore(bt.own.vmstack) }
 		if (bt.kind & undoErr) != 0 { s.err = bt.own.err }
 		if (bt.kind & undoTape) != 0 {
 			s.vpos = bt.own.vpos
@@ -8432,7 +8755,7 @@ func (s *symstr) unwind(bt *backtrack) {
 		if (bt.kind & undoCtx) != 0 { s.tie.Context = bt.tie.context }
 		if (bt.kind & undoHead) != 0 { s.tie.vmhead = bt.tie.vmhead }
 		if (bt.kind & undoPack) != 0 { s.tie.vmpack = bt.tie.vmpack }
-		if (bt.kind & undoStack) != 0 { if bt.tie.vmpack != nil { s.tie.vmpack = bt.tie.vmpack.clone() } else { s.tie.vmpack = nil } }
+		if (bt.kind & undoStack) != 0 { s.tie.vmstack.restore(bt.tie.vmstack) }
 		if (bt.kind & undoErr) != 0 { s.tie.err = bt.tie.err }
 		if (bt.kind & undoTape) != 0 {
 			s.tie.vpos = bt.tie.vpos
@@ -8469,6 +8792,7 @@ func (s *symstr) ensured_syms() bool {
 	}
 
 	for len(s.syms) == 0 && s.err == nil && len(s.ops) > 0 { s.step() }
+	if len(s.syms) > 0 && s.matching != opEnd { s.unblobHead() }
 	if len(s.syms) > 0 { return true }
 
 	// Safely assert tape exhaustion without masking real VM errors!
@@ -8524,6 +8848,71 @@ func (s *symstr) pop_head() posym {
 	return ps
 }
 
+// bindBlob registers obj into the VM-local blob registry and returns a blob
+// symbol for it. Unlike `vocab.ephemeral`, the registry belongs to this symstr
+// only, so it's lock-free and it never outlives the evaluation.
+//
+// A blob symbol is a SymBlb whose ID is the registry index, its Idx is the
+// Idx of the face and its Rank bits hold the kind of the face, so any view of
+// it (String, len, runes) reads the face (see Symbol.unblob), only the packer
+// turns it back into the object.
+func (s *symstr) bindBlob(obj any, face Symbol) Symbol {
+	idx := len(s.blobs)
+	s.blobs = append(s.blobs, vmblob{obj, face})
+	return packSymbol(uint32(idx), face.Idx(), SymBlb, int(face.Kind()))
+}
+
+// blob resolves a blob symbol, which might be bound by the tied generator
+// (e.g. the matcher packing symbols popped from `s.tie`).
+func (s *symstr) blob(sym Symbol) *vmblob {
+	if !sym.isBlob() { return nil }
+	for p := s; p != nil; p = p.tie {
+		if i := int(sym.id()); i < len(p.blobs) && p.blobs[i].face.Idx() == sym.Idx() && int(p.blobs[i].face.Kind()) == sym.Rank() {
+			return &p.blobs[i]
+		}
+	}
+	return nil
+}
+
+// face returns the face symbol of a blob symbol, or the symbol itself.
+func (s *symstr) face(sym Symbol) Symbol {
+	if b := s.blob(sym); b != nil { return b.face }
+	return sym
+}
+
+// unblobHead unrolls blobs of SymSeq faces at the head of the tape back into
+// plain symbols, so the matcher compares names segment by segment (e.g. `/`)
+// and closures by their syntax. Blobs of single symbols stay on the tape.
+func (s *symstr) unblobHead() {
+	for len(s.syms) > 0 && s.err == nil {
+		b := s.blob(s.syms[0].Symbol)
+		if b == nil || b.face.Kind() != SymSeq { return }
+		v, ok := b.obj.(Value)
+		if !ok { return }
+
+		rest := append([]posym(nil), s.syms[1:]...)
+		s.syms = s.syms[:0]
+
+		mark := len(s.ops)
+		s.unblobbing = true
+		s.ops = append(s.ops, s.matching)
+		s.operands = append(s.operands, v)
+		for len(s.ops) > mark && s.err == nil { s.step() }
+		s.unblobbing = false
+
+		s.syms = append(s.syms, rest...)
+	}
+}
+
+// releaseBlobs drops blobs bound since mark, zeroing the slots so the GC
+// is not pinned by the reused registry.
+func (s *symstr) releaseBlobs(mark int) {
+	if mark < len(s.blobs) {
+		clear(s.blobs[mark:])
+		s.blobs = s.blobs[:mark]
+	}
+}
+
 // clone securely deep-copies the volatile execution stacks.
 func (st vmstack) clone() vmstack {
 	return vmstack{
@@ -8762,6 +9151,14 @@ func (s *symstr) pack(ps posym, reverse bool) {
 		}
 	}
 
+	if b := s.blob(ps.Symbol); b != nil {
+		if v, ok := b.obj.(Value); ok {
+			s.vmpack.shift(v, reverse)
+			return
+		}
+		ps.Symbol = b.face
+	}
+
 	switch ps.Symbol {
 	case symDash:
 		if ps.Pos == NoPos {
@@ -9003,11 +9400,12 @@ func (p *symsmem) readRune() error {
 		if len(p.syms) == 0 { return io.EOF }
 
 		sym := p.pop_head() // sym is posym
+		face := sym.unblob() // blobs are read as their faces
 
 		// Unpack compound symbols safely by mapping to []posym
-		if sym.Kind() == SymSeq {
+		if face.Kind() == SymSeq {
 			vocab.seqmut.RLock()
-			seq := vocab.sequences[sym.Idx()]
+			seq := vocab.sequences[face.Idx()]
 			vocab.seqmut.RUnlock()
 
 			unpacked := make([]posym, len(seq))
@@ -9021,9 +9419,9 @@ func (p *symsmem) readRune() error {
 		p.mem = append(p.mem, sym) // Collect primitive posym
 		p.vpos = sym.Pos           // Inherit AST position for string buffer
 
-		switch sym.Kind() {
+		switch face.Kind() {
 		case SymPct, SymInl:
-			u := uint32(sym.Idx())
+			u := uint32(face.Idx())
 			ln := (u >> 24) & 0x3
 			buf := make([]byte, ln)
 			if ln > 0 { buf[0] = byte(u) }
@@ -9032,22 +9430,22 @@ func (p *symsmem) readRune() error {
 			p.str = string(buf)
 		case SymRaw:
 			vocab.strmut.Lock()
-			p.str = vocab.strings[sym.Idx()]
+			p.str = vocab.strings[face.Idx()]
 			vocab.strmut.Unlock()
 		case SymEph:
-			vocab.ephmut.Lock()
-			p.str = vocab.ephemeral[sym.Idx()]
-			vocab.ephmut.Unlock()
+			vocab.ephmut.RLock()
+			p.str = vocab.ephemeral[face.Idx()]
+			vocab.ephmut.RUnlock()
 		case SymInt:
 			var buf [24]byte
 			vocab.nummut.Lock()
-			n := vocab.numbers[sym.Idx()]
+			n := vocab.numbers[face.Idx()]
 			vocab.nummut.Unlock()
 			p.str = string(strconv.AppendInt(buf[:0], int64(n), 10))
 		case SymFlt:
 			var buf [64]byte
 			vocab.nummut.Lock()
-			n := vocab.numbers[sym.Idx()]
+			n := vocab.numbers[face.Idx()]
 			vocab.nummut.Unlock()
 			p.str = string(strconv.AppendFloat(buf[:0], math.Float64frombits(n), 'g', -1, 64))
 		}
@@ -9071,11 +9469,12 @@ func (s *symstr) readRune() error {
 		if len(s.syms) == 0 { return io.EOF }
 
 		sym := s.pop_head() // sym is posym
+		face := sym.unblob() // blobs are read as their faces
 
 		// Unpack compound symbols safely by mapping to []posym
-		if sym.Kind() == SymSeq {
+		if face.Kind() == SymSeq {
 			vocab.seqmut.RLock()
-			seq := vocab.sequences[sym.Idx()]
+			seq := vocab.sequences[face.Idx()]
 			vocab.seqmut.RUnlock()
 
 			unpacked := make([]posym, len(seq))
@@ -9088,9 +9487,9 @@ func (s *symstr) readRune() error {
 
 		s.vpos = sym.Pos // Inherit AST position for string buffer
 
-		switch sym.Kind() {
+		switch face.Kind() {
 		case SymPct, SymInl:
-			u := uint32(sym.Idx())
+			u := uint32(face.Idx())
 			ln := (u >> 24) & 0x3
 			buf := make([]byte, ln)
 			if ln > 0 { buf[0] = byte(u) }
@@ -9099,22 +9498,22 @@ func (s *symstr) readRune() error {
 			s.str = string(buf)
 		case SymRaw:
 			vocab.strmut.Lock()
-			s.str = vocab.strings[sym.Idx()]
+			s.str = vocab.strings[face.Idx()]
 			vocab.strmut.Unlock()
 		case SymEph:
-			vocab.ephmut.Lock()
-			s.str = vocab.ephemeral[sym.Idx()]
-			vocab.ephmut.Unlock()
+			vocab.ephmut.RLock()
+			s.str = vocab.ephemeral[face.Idx()]
+			vocab.ephmut.RUnlock()
 		case SymInt:
 			var buf [24]byte
 			vocab.nummut.Lock()
-			n := vocab.numbers[sym.Idx()]
+			n := vocab.numbers[face.Idx()]
 			vocab.nummut.Unlock()
 			s.str = string(strconv.AppendInt(buf[:0], int64(n), 10))
 		case SymFlt:
 			var buf [64]byte
 			vocab.nummut.Lock()
-			n := vocab.numbers[sym.Idx()]
+			n := vocab.numbers[face.Idx()]
 			vocab.nummut.Unlock()
 			s.str = string(strconv.AppendFloat(buf[:0], math.Float64frombits(n), 'g', -1, 64))
 		}
@@ -9174,14 +9573,22 @@ func (s *symstr) match(val Value) (matched bool, res, rem Value, stems []Value)
 	gen := &symstr{Context: s.Context}
 	if trail {
 		gen.ops = append(gen.ops, opEnd, opUnrollRev) // Reverse unroll
+		gen.matching = opRetRev
 	} else {
 		gen.ops = append(gen.ops, opEnd, opUnroll)    // Forward unroll
+		gen.matching = opRet
 	}
 	gen.operands = append(gen.operands, val)
 
 	// LAYER 2: Configure this symstr instance as the Matcher
 	s.tie = gen
 
+	if vmdebugging.Load() {
+		var d = s.vmdebug()
+		if d.trace { s.disasm("match", pat, val) }
+		defer func() { if d.cont == s { d.cont = nil } } ()
+	}
+
 	// Execute the Matcher! (It packs its own 'res' AST internally via opRet/opRetPack/opRetMatch)
 	for len(s.ops) > 0 && s.err == nil { s.step() }
 
@@ -9197,6 +9604,7 @@ func (s *symstr) match(val Value) (matched bool, res, rem Value, stems []Value)
 	// 2. Extract `rem` by natively flushing whatever is left in the Generator!
 	var remPopped bool
 	gen.vmpack = &vmpack{}
+	gen.matching = opEnd // the packer takes the blobs as they are
 
 	// ALWAYS drain leftover symbols so gen.pack() can dynamically reshape the AST
 	for gen.ensured_syms() {
@@ -9250,6 +9658,8 @@ func (s *symstr) match(val Value) (matched bool, res, rem Value, stems []Value)
 		}
 	}
 
+	gen.releaseBlobs(0) // the generator halted, stems and rem are packed
+
 	// Sanity Warnings
 	if checkpoints {
 		if matched {
@@ -9323,13 +9733,17 @@ func (s *symstr) evals(nodes ...Value) (res []Value) {
 
 	startOps := len(s.ops)
 	startRes := len(s.results)
+	defer s.releaseBlobs(len(s.blobs)) // results are packed, blobs are done
 
 	// Bootstrap with opExpand!
 	// The matcher frameworks strictly rely on this to stringify literal nodes.
 	s.ops = append(s.ops, opExpand)
 	s.operands = append(s.operands, nodes)
 
+	if vmdebugging.Load() && s.vmdebug().trace { s.disasm("evals", nodes...) }
+
 	for len(s.ops) > startOps && s.err == nil { s.step() }
+	if d := s.debugger; d != nil && d.cont == s { d.cont = nil }
 
 	if s.err != nil && s.err != io.EOF { erro(s.Context, "%v", s.err) }
 
@@ -11064,6 +11478,10 @@ func _fLoadedProjs(u *universe, t diagtype, f string) []*diag {
 }
 
 func _diagnostic(c Context) *diagnostic { return cast[*diagnostic](c) }
+func _diagcontrol(c Context) *diagcontrol {
+	if d := _diagnostic(c); d != nil { return d.ctl }
+	return nil
+}
 
 const diagnostic_count_bytes = false // counting bytes versus lines
 const diagnostic_limit = 256
@@ -11094,6 +11512,10 @@ type diagpoint struct {
 	argCount uint8
 
 	stack    []byte
+	related  bool   // a sub-message (_f, traces) of the previous point
+	rule     string // target of the executing rule (-diag-format only)
+	cat      warncat // category of a warning (see -no-warn)
+	werror   bool    // a warning turned into an error by -Werror
 }
 
 type diagnostic struct {
@@ -11105,6 +11527,15 @@ type diagnostic struct {
 	count   int
 	erros   int
 	flushed int
+	ctl     *diagcontrol // shared by the diagnostics of a universe
+}
+
+// diagcontrol holds the -max-errors, -Werror, -no-warn and -diag-format
+// controls of a universe.
+type diagcontrol struct {
+	maxErros int // diagnostic_limit_erros if 0
+	warns    diagwarns
+	format   diagformatter
 }
 
 type diag_flush struct{}
@@ -11163,6 +11594,11 @@ func (d *diagnostic) search_diag(rx *regexp.Regexp) *diagpoint {
 func (d *diagnostic) point(ctx Context, dt diagtype, f string, args ...any) *diagpoint {
 	if dt != diagPrompt { f = strings.TrimSpace(f) }
 
+	var rule string
+	if d.ctl != nil && d.ctl.format.name != "" && dt != diagPrompt {
+		if e := _entry(ctx); e != nil && e.destiny() != nil { rule = e.destiny().String() }
+	}
+
 	d.Lock()
 	if d.count >= diagnostic_limit {
 		d.Unlock(); d.flush(ctx); d.Lock()
@@ -11176,6 +11612,9 @@ func (d *diagnostic) point(ctx Context, dt diagtype, f string, args ...any) *dia
 	ptr.position = _position(ctx)
 	ptr.f = f
 	ptr.stack = nil
+	ptr.related = false
+	ptr.rule = rule
+	ptr.cat, ptr.werror = "", false
 	ptr.argCount = uint8(len(args))
 
 	// DOD SBO Routing: Keep 0-4 arguments perfectly stack-bound!
@@ -11245,18 +11684,33 @@ func (d *diagnostic) flush(ctx Context) (errs int) {
 	}
 	d.Unlock()
 
+	var ctl = d.ctl
+	if ctl == nil { ctl = new(diagcontrol) }
+
 	var cb compactbuilds
+	var recs []*diagrecord
+	defer func() { // also the records before a too_many_erros panic
+		if len(recs) > 0 { ctl.format.emit(recs) }
+	} ()
 
+	var limit = diagnostic_limit_erros
+	if ctl.maxErros != 0 { limit = ctl.maxErros }
 	for i := 0; i < n; i++ {
 		p := &toFlush[i]
 
-		if x, y := diagnostic_limit_erros, d.erros+errs; 0 < x && x < y {
+		if x, y := limit, d.erros+errs; 0 < x && x < y {
 			panic(too_many_erros{y})
 		}
 		if x, y := diagnostic_limit_bytes, d.flushed; 0 < x && x < y && false {
 			panic(too_many_diags{y})
 		}
 
+		if ctl.format.name != "" && (p.t != diagPrompt || p.related) {
+			if p.t == diagError { errs += 1 }
+			recs = ctl.format.add(recs, p)
+			continue
+		}
+
 		startLen := len(cb.buf) // Track length for holistic byte-counting
 
 		// 1. 100% Zero-Allocation Prefixing via Symbol Domain
@@ -11301,6 +11755,8 @@ func (d *diagnostic) flush(ctx Context) (errs int) {
 			cb.writef(p.f, activeArgs...)
 		}
 
+		if s := p.suffix(); s != "" { cb.write(s) }
+
 		// Ensure newline formatting for non-prompt diags.
 		if p.t != diagPrompt && (len(p.f) > 0 && p.f[len(p.f)-1] != '\n') {
 			cb.write("\n")
@@ -11340,6 +11796,247 @@ func (d *diagnostic) flush(ctx Context) (errs int) {
 
 func flush(ctx Context) int { i, _ := do(ctx, diag_flush{}).(int); return i }
 
+// warncat is the category of a warning, passed to warn() to be disabled by
+// -no-warn(CATEGORY) or a `# smart:nowarn CATEGORY` comment.
+type warncat string
+
+// diagwarns holds the warning controls: -Werror, -no-warn and the lines
+// silenced by `# smart:nowarn [CATEGORY...]` (see scanner.nowarnPragma).
+type diagwarns struct {
+	sync.Mutex
+	werror   bool
+	disabled map[warncat]bool // "all" disables every warning
+	pragmas  map[diagpragma][]warncat
+}
+
+type diagpragma struct{ file Symbol; line int }
+
+// nowarn tells if a warning of the category is disabled at the position
+// of the context.
+func (w *diagwarns) nowarn(ctx Context, cat warncat) bool {
+	w.Lock(); defer w.Unlock()
+	if w.disabled["all"] || (cat != "" && w.disabled[cat]) {
+		return true
+	} else if len(w.pragmas) == 0 {
+		return false
+	}
+
+	var pos = _position(ctx)
+	cats, ok := w.pragmas[diagpragma{pos.Filename, pos.Line}]
+	if ok && len(cats) == 0 { return true }
+	for _, c := range cats { if c == cat { return true } }
+	return false
+}
+
+// suffix marks the category of a warning and -Werror, e.g. " [deprecated]".
+func (p *diagpoint) suffix() string {
+	switch {
+	case p.werror && p.cat != "": return " [-Werror," + string(p.cat) + "]"
+	case p.werror:                return " [-Werror]"
+	case p.cat != "":             return " [" + string(p.cat) + "]"
+	}
+	return ""
+}
+
+// diagformatter renders the flushed diagnostics as JSON lines or a SARIF
+// log instead of text (-diag-format=json|sarif, -diag-output=FILE).
+type diagformatter struct {
+	sync.Mutex
+	name    string // json, sarif
+	out     io.Writer
+	file    *os.File // -diag-output, see close
+	results []*diagrecord // collected for sarif, see report
+}
+
+// diagrecord is a diagnostic with its sub-messages and call stack.
+type diagrecord struct {
+	Level   string        `json:"level"`
+	File    string        `json:"file,omitempty"`
+	Line    int           `json:"line,omitempty"`
+	Column  int           `json:"column,omitempty"`
+	Message string        `json:"message"`
+	Rule    string        `json:"rule,omitempty"`
+	Related []*diagrecord `json:"related,omitempty"`
+	Stack   []diagframe   `json:"stack,omitempty"`
+}
+
+type diagframe struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function"`
+}
+
+// add appends the point to recs, sub-messages go to the last record.
+func (f *diagformatter) add(recs []*diagrecord, p *diagpoint) []*diagrecord {
+	var args = p.argsOver
+	if p.argCount <= 4 { args = p.args[:p.argCount] }
+
+	var r = &diagrecord{Line: p.position.Line, Column: p.position.Column, Rule: p.rule}
+	if p.position.Filename != 0 { r.File = p.position.Filename.String() }
+	if len(args) == 0 { r.Message = p.f } else { r.Message = fmt.Sprintf(p.f, args...) }
+	r.Message = strings.TrimSpace(r.Message) + p.suffix()
+
+	switch p.t {
+	case diagError: r.Level = "error"
+	case diagWarn:  r.Level = "warning"
+	case diagDebug: r.Level = "debug"
+	default:        r.Level = "info"
+	}
+
+	if last := len(recs) - 1; p.related && last >= 0 {
+		recs[last].Related = append(recs[last].Related, r)
+	} else {
+		recs = append(recs, r)
+	}
+	if last := len(recs) - 1; p.stack != nil {
+		recs[last].Stack = diagframes(p.stack)
+	}
+	return recs
+}
+
+// diagframes parses the frames of _callstack ("file:line:info: func(args)").
+func diagframes(stack []byte) (frames []diagframe) {
+	for _, s := range strings.Split(strings.TrimSpace(string(stack)), "\n") {
+		loc, fn, ok := strings.Cut(strings.TrimSpace(s), ":info: ")
+		if !ok { continue }
+		if i := strings.Index(fn, "  ("); i > 0 { fn = fn[:i] } // (N more)
+		if i := strings.IndexByte(fn, '\t'); i > 0 { fn = fn[:i] } // <---- panic
+		if i := strings.LastIndexByte(fn, '('); i > 0 { fn = fn[:i] }
+
+		var fr = diagframe{File: loc, Function: fn}
+		if i := strings.LastIndexByte(loc, ':'); i > 0 {
+			fr.File = loc[:i]
+			fr.Line, _ = strconv.Atoi(loc[i+1:])
+		}
+		frames = append(frames, fr)
+	}
+	return
+}
+
+func (f *diagformatter) emit(recs []*diagrecord) {
+	f.Lock(); defer f.Unlock()
+	if f.name == "sarif" {
+		f.results = append(f.results, recs...)
+		return
+	}
+	var out = f.out
+	if out == nil { out = stderr }
+	for _, r := range recs {
+		if b, err := enc_json.Marshal(r); err == nil {
+			fmt.Fprintf(out, "%s\n", b)
+		}
+	}
+}
+
+// report writes the SARIF (2.1.0) log of the collected diagnostics.
+func (f *diagformatter) report() {
+	f.Lock(); defer f.Unlock()
+	if f.name != "sarif" { return }
+
+	type sarifMessage struct {
+		Text string `json:"text"`
+	}
+	type sarifRegion struct {
+		StartLine   int `json:"startLine,omitempty"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+	type sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+	type sarifPhysical struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           *sarifRegion  `json:"region,omitempty"`
+	}
+	type sarifLogical struct {
+		FullyQualifiedName string `json:"fullyQualifiedName"`
+	}
+	type sarifLocation struct {
+		ID               *int           `json:"id,omitempty"`
+		Message          *sarifMessage  `json:"message,omitempty"`
+		PhysicalLocation *sarifPhysical `json:"physicalLocation,omitempty"`
+		LogicalLocations []sarifLogical `json:"logicalLocations,omitempty"`
+	}
+	type sarifFrame struct {
+		Location sarifLocation `json:"location"`
+	}
+	type sarifStack struct {
+		Frames []sarifFrame `json:"frames"`
+	}
+	type sarifResult struct {
+		RuleID           string          `json:"ruleId,omitempty"`
+		Level            string          `json:"level"`
+		Message          sarifMessage    `json:"message"`
+		Locations        []sarifLocation `json:"locations,omitempty"`
+		RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+		Stacks           []sarifStack    `json:"stacks,omitempty"`
+	}
+
+	var physical = func(file string, line, column int) *sarifPhysical {
+		if file == "" { return nil }
+		var p = &sarifPhysical{ArtifactLocation: sarifArtifact{URI: file}}
+		if line > 0 { p.Region = &sarifRegion{line, column} }
+		return p
+	}
+
+	var results = []sarifResult{}
+	for _, r := range f.results {
+		var res = sarifResult{RuleID: r.Rule, Level: "note", Message: sarifMessage{r.Message}}
+		switch r.Level {
+		case "error", "warning": res.Level = r.Level
+		}
+		if p := physical(r.File, r.Line, r.Column); p != nil {
+			res.Locations = []sarifLocation{{PhysicalLocation: p}}
+		}
+		for i, a := range r.Related {
+			var id = i + 1
+			res.RelatedLocations = append(res.RelatedLocations, sarifLocation{
+				ID: &id, Message: &sarifMessage{a.Message},
+				PhysicalLocation: physical(a.File, a.Line, a.Column),
+			})
+		}
+		if len(r.Stack) > 0 {
+			var st sarifStack
+			for _, fr := range r.Stack {
+				st.Frames = append(st.Frames, sarifFrame{sarifLocation{
+					PhysicalLocation: physical(fr.File, fr.Line, 0),
+					LogicalLocations: []sarifLogical{{fr.Function}},
+				}})
+			}
+			res.Stacks = []sarifStack{st}
+		}
+		results = append(results, res)
+	}
+
+	var log = map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{"driver": map[string]any{
+				"name": "smart", "informationUri": "https://extbit.io/smart",
+			}},
+			"results": results,
+		}},
+	}
+
+	var out = f.out
+	if out == nil { out = stderr }
+	if b, err := enc_json.MarshalIndent(log, "", "  "); err == nil {
+		fmt.Fprintf(out, "%s\n", b)
+	}
+	f.results = nil
+}
+
+// close writes the SARIF log and closes the -diag-output file.
+func (f *diagformatter) close() {
+	f.report()
+	f.Lock(); defer f.Unlock()
+	if f.file == nil { return }
+	if err := f.file.Close(); err != nil {
+		fmt.Fprintf(stderr, "-diag-output: %v\n", err)
+	}
+	f.file, f.out = nil, nil
+}
+
 func join_diags_msg(sep string, ds ...*diag) string {
 	var cb compactbuilds
 	for i, d := range ds {
@@ -11395,12 +12092,15 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 	var cs_i, cs_j int = 5, 0
 	var cs callstack
 	var dt diagtype = -1 // ARCHITECTURAL FIX: Sentinel state
+	var cat warncat
+	var werror bool
 	var ds []*diag
 	var args []any
 
 	for _, a := range a {
 		switch t := a.(type) {
 		case diagtype: dt = t
+		case warncat: cat = t
 		case unwind: unwound = true
 		case trace_ctx: trCtx = t.int
 		case trace_val: trV_i, trV_v = t.int, t.val
@@ -11425,6 +12125,14 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 		if noCS { dt = diagPrompt } else { dt = diagDebug }
 	}
 
+	if dt != diagWarn {
+	} else if ctl := _diagcontrol(ctx); ctl == nil {
+	} else if ctl.warns.nowarn(ctx, cat) {
+		return nil
+	} else if ctl.warns.werror {
+		dt, werror = diagError, true
+	}
+
 	// 1. Process the primary format message
 	// (Eager `ps` position string and manual `\n` appendages have been entirely deleted.
 	// `flush()` naturally prefixes `diagDebug` and strictly guarantees exactly one trailing newline).
@@ -11434,8 +12142,9 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 			p, _ = do(ctx, diag{dt, t.f, t.a}).(*diagpoint)
 		}
 	case []*diag:
-		for _, t := range t {
+		for i, t := range t {
 			p, _ = do(ctx, diag{dt, t.f, t.a}).(*diagpoint)
+			if p != nil && i > 0 { p.related = true }
 		}
 	case string:
 		if true || noCS || dt == diagPrompt || dt == diagDebug {
@@ -11449,10 +12158,12 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 	default:
 		p, _ = do(ctx, diag{dt, typeof(t)+": %v", args}).(*diagpoint)
 	}
+	if p != nil { p.cat, p.werror = cat, werror }
 
 	// 2. Process additional `_f` sequences
 	for _, d := range ds {
 		p, _ = do(ctx, diag{d.t, d.f, d.a}).(*diagpoint)
+		if p != nil { p.related = true }
 	}
 
 	// 3. Trace context engine resolution (100% Deferred Formatting)
@@ -11492,6 +12203,7 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 			if !strings.HasSuffix(f, "\n") { f += "\n" }
 
 			p, _ = do(c, diag{diagPrompt, f, dArgs}).(*diagpoint)
+			if p != nil { p.related = true }
 		}
 	}
 
@@ -11576,6 +12288,7 @@ func debug(ctx Context, f any, a ...any) *diagpoint {
 		if !strings.HasSuffix(f, "\n") { f += "\n" }
 
 		p, _ = do(ctx, diag{diagPrompt, f, da}).(*diagpoint)
+		if p != nil { p.related = true }
 	}
 
 	if noCS {
@@ -13106,7 +13819,32 @@ func (s *scanner) scanComment(ctx Context) (res string) {
 
 	// We should intern identifiers, words, and numbers. We should not intern
 	// comments (they are long and rarely repeated) to avoid bloating the pool.
-	return string(s.src[offs:s.offset])
+	res = string(s.src[offs:s.offset])
+	if strings.HasPrefix(res, "smart:nowarn") { s.nowarnPragma(ctx, offs, res) }
+	return
+}
+
+// nowarnPragma registers `# smart:nowarn [CATEGORY...]` which silences the
+// warnings of its line, or of the next line if the comment is on its own.
+func (s *scanner) nowarnPragma(ctx Context, offs int, text string) {
+	var fields = strings.Fields(text)
+	if fields[0] != "smart:nowarn" { return }
+
+	var ctl = _diagcontrol(ctx)
+	if ctl == nil { return }
+
+	var line = s.file.Line(s.file.Pos(offs))
+	if hash := bytes.LastIndexByte(s.src[:offs], '#'); hash >= s.offsetLine {
+		if strings.TrimSpace(string(s.src[s.offsetLine:hash])) == "" { line++ }
+	}
+
+	var cats = []warncat{}
+	for _, f := range fields[1:] { cats = append(cats, warncat(f)) }
+
+	var w = &ctl.warns
+	w.Lock(); defer w.Unlock()
+	if w.pragmas == nil { w.pragmas = make(map[diagpragma][]warncat) }
+	w.pragmas[diagpragma{s.file.name, line}] = cats
 }
 
 func (s *scanner) scanIdentifier(ctx Context) {
@@ -15885,7 +16623,7 @@ func (p *compiler) strcomp() *strcomp {
 		} else {
 			elems = append(elems, p.expr())
 		}
-		if p.pos == pos { erro(p, "syntax error") }
+		if p.pos == pos { erro(p, "syntax error"); break }
 	}
 
 	p.expect(COMPOSED)
@@ -16687,6 +17425,7 @@ func (p *compiler) identity(tok token, name Value, isClosure bool) (obj Value, s
 	switch tok {
 	case LPAREN:
 		if obj = p.resolve(name.Pos(), sym, isClosure); obj != nil { return }
+		if obj = p.urlselect(name, isClosure); obj != nil { return }
 		if truly(p.Context, opt_ident{}) { return name, sym, opts }
 
 	case LBRACE:
@@ -16708,6 +17447,25 @@ func (p *compiler) identity(tok token, name Value, isClosure bool) (obj Value, s
 	return
 }
 
+// urlselect turns a dotted name like `u.query.key` into the selection
+// `u->query.key` if the leading part of the name is defined as an url.
+func (p *compiler) urlselect(name Value, isClosure bool) Value {
+	q, ok := name.(*qualword)
+	if !ok || q.len() < 2 { return nil }
+	for i := q.len() - 1; 0 < i; i -= 1 {
+		var head Value = q.elems[0]
+		if 1 < i { head = &qualword{elements{q.elems[:i]}} }
+		d, _ := p.resolve(head.Pos(), intern(ident(p, head)), isClosure).(*def)
+		if d == nil { continue }
+		if _, y := unloc(d.value).(*url); !y { return nil }
+
+		var rest Value = q.elems[i]
+		if i < q.len()-1 { rest = &qualword{elements{q.elems[i:]}} }
+		return _arrow(name.Pos(), SELECT_PROP, d, rest)
+	}
+	return nil
+}
+
 type parse_foreach_ctx struct{ Context ; a *auto }
 func (p *parse_foreach_ctx) do(ctx Context, op any) (_ any) {
 	switch t := op.(type) {
@@ -18488,7 +19246,7 @@ func (p *compiler) eval_(doc *commentgroup, g *clause_opts, _ int) {
 	case *builtin:
 		// Assuming builtin.name was upgraded to a Symbol when we updated knownobject
 		switch x.name {
-		case symPlain, symPrint, symPrintf:
+		case symPlain, symPrint, symPrintf, symMatcher, symLanginfo:
 			// defer func(c Context) { p.Context = c } (p.Context)
 			// p.Context = closure_with(project_ctx{p.Context, p.project}, _term(p.Context).scope)
 			p.evoke(x, opts, g.spec[1:])
@@ -18978,6 +19736,64 @@ func (p *compiler) pre_project_set(args ...Value) {
 	}
 }
 
+// toolchainVars are the variables of a toolchain profile used by smart
+// itself, any of them is optional, e.g. a profile `.smart/toolchains/aarch64`
+// could be:
+//     CC = ccache aarch64-linux-gnu-gcc
+//     CXX = aarch64-linux-gnu-g++
+//     SYSROOT = /opt/sysroots/aarch64-linux-gnu
+//     TARGET = aarch64-linux-gnu
+//     AR = aarch64-linux-gnu-ar
+// Other names (like AR) are only defined for the recipes and probes.
+var toolchainVars = []string{ "CC", "CXX", "SYSROOT", "TARGET" }
+
+// toolchain sources the toolchain profile selected by -toolchain=NAME into
+// the globe scope, so that configure probes, (extract-deps) and (grep) are
+// all seeing the same CC/CXX/SYSROOT/TARGET. The profile is
+// searched as `.smart/toolchains/NAME` from the workdir upwards, and it's a
+// list of `NAME = value` lines (comments start with '#').
+func (p *compiler) toolchain(ctx Context, name string) {
+	u := _universe(ctx)
+
+	var filename Symbol
+	walkSmartBaseDirs(ctx, u.workdir, func(s Symbol) bool {
+		sym := __symPathJoin(s, symDotSmart, intern("toolchains"), intern(name))
+		if f := _stat(ctx, sym, stat_nonexist{true}); f != nil && f.exists() && !f.isDir() {
+			filename = sym
+			return false
+		}
+		return true
+	})
+	if filename == symEmpty {
+		erro(pc(ctx,u.workdir), "toolchain '%s' not found in .smart/toolchains", name, unwind{})
+		return
+	}
+
+	text := load_source_bytes(ctx, filename.String())
+	for n, line := range strings.Split(string(text), "\n") {
+		if line = strings.TrimSpace(line); line == "" || line[0] == '#' { continue }
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			erro(pc(ctx,filename), "%v:%d: expect NAME = value: %s", filename, n+1, line)
+			continue
+		}
+		var vals []Value
+		if s := strings.TrimSpace(line[i+1:]); s != "" {
+			if v := p.text(filename, s); v != nil { vals = merge(v) }
+		}
+		u.globe.def(ctx, defVoid, intern(strings.TrimSpace(line[:i])), vals...)
+	}
+
+	u.globe.def(ctx, defVoid, intern("TOOLCHAIN"), _rw(0, name))
+	if u.verbose {
+		for _, s := range toolchainVars {
+			if v := u.toolchainVar(ctx, s); v != "" {
+				prompt(ctx, "toolchain %s: %s = %s\n", name, s, v)
+			}
+		}
+	}
+}
+
 func (p *compiler) openscope(marker Symbol) *scope {
 	var host *project
 	if !p.nextOpenScopeNilOwner { host = p.project } else {
@@ -20149,6 +20965,8 @@ type get_include_opts struct{}
 type include_opts struct {
 	*clause_opts
     ifExists bool `if-exists,ifexists`
+    autoconf bool `ac,autoconf` // translate AC_CHECK_* macros (configure.ac)
+    makefile bool `make,makefile` // translate a GNU Makefile
 }
 type include_ctx struct {
     Context
@@ -20232,6 +21050,22 @@ func (p *compiler) include(doc *commentgroup, g *clause_opts, _ int) {
 		return
 	}
 
+	if opts.autoconf {
+		var out bytes.Buffer
+		if e := autoconf(p, &out, p.project, string(text)); e != nil {
+			erro(p, "%v: %v", f.fullname(), e)
+			return
+		}
+		text = out.Bytes()
+	} else if opts.makefile {
+		var out bytes.Buffer
+		if e := makefile(p, &out, string(text)); e != nil {
+			erro(p, "%v: %v", f.fullname(), e)
+			return
+		}
+		text = out.Bytes()
+	}
+
 	// State Protection Barrier: Isolate the parent compiler's scanning registers
 	func() {
 		cc := include_ctx{p.Context, opts, s, val.Pos()}
@@ -20418,23 +21252,7 @@ func (p *compiler) saveConfiguration() {
 	}
 
 	// 2. I/O OPTIMIZATION: Serialize entirely in memory first!
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "# %s (%s)\n", p.project.name.String(), p.project.spec.String())
-
-	for _, c := range configs {
-		fmt.Fprintf(&buf, "configure %s =", c.name)
-
-		// SAFE SERIALIZATION: Prevent `{}` and `[]` parsing crashes
-		if c.value != nil && !isTrivial(c.value) {
-			if s := c.value.String(); s != "" && s != "{}" && s != "[]" {
-				fmt.Fprintf(&buf, " %s", s)
-			}
-		}
-		fmt.Fprintf(&buf, "\n")
-	}
-
-	fmt.Fprintf(&buf, "\n# %d configs.\n", len(configs))
-	var newPayload = buf.Bytes()
+	var newPayload = p.project.serializeConfiguration()
 	var fnStr = fnSym.String()
 
 	// 3. ZERO-I/O CACHE SYNC: Prevent timestamp thrashing!
@@ -20475,6 +21293,31 @@ func (p *compiler) saveConfiguration() {
 	p.project.configuration = f // saved configuration.sm
 }
 
+// serializeConfiguration formats configs as the configuration.sm source.
+func (p *project) serializeConfiguration() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s (%s)\n", p.name.String(), p.spec.String())
+
+	for _, c := range p.configs {
+		if x := p.probes[c.name]; x != nil && x.pinned {
+			fmt.Fprintf(&buf, "configure %s -pinned =", c.name)
+		} else {
+			fmt.Fprintf(&buf, "configure %s =", c.name)
+		}
+
+		// SAFE SERIALIZATION: Prevent `{}` and `[]` parsing crashes
+		if c.value != nil && !isTrivial(c.value) {
+			if s := c.value.String(); s != "" && s != "{}" && s != "[]" {
+				fmt.Fprintf(&buf, " %s", s)
+			}
+		}
+		fmt.Fprintf(&buf, "\n")
+	}
+
+	fmt.Fprintf(&buf, "\n# %d configs.\n", len(p.configs))
+	return buf.Bytes()
+}
+
 func nonsource(name string) bool {
     if name == "" || name == symConfigurationSm.String() || strings.HasPrefix(name, ".#") ||
         !(strings.HasSuffix(name, ".smart") || strings.HasSuffix(name, ".sm")) { return true }
@@ -20642,11 +21485,39 @@ func (p *compiler) parseArgs(ctx Context, a []string) {
 	u := _universe(ctx)
 	base := symBaseWorkDir
 
-	if s := strings.Join(a, " "); s != "" {
+	// -config-set NAME=VALUE and -config-unset NAME take the next argument,
+	// like -config-set(NAME=VALUE ...) and -config-unset(NAME ...) do.
+	var configSet, configUnset, rest []string
+	for i := 0; i < len(a); i++ {
+		switch s := a[i]; {
+		case s == "-config-set" && i+1 < len(a):
+			i += 1; configSet = append(configSet, a[i])
+		case s == "-config-unset" && i+1 < len(a):
+			i += 1; configUnset = append(configUnset, a[i])
+		default:
+			rest = append(rest, s)
+		}
+	}
+
+	if s := strings.Join(rest, " "); s != "" {
 		if v := p.text(base, s); v != nil {
 			args = parseOpts(p, &u.commandline, merge(v)...)
 		}
 	}
+	for _, s := range configSet {
+		if k, v, ok := strings.Cut(s, "="); !ok {
+			if x := p.text(base, s); x != nil {
+				u.configSet = append(u.configSet, x) // reported by config
+			}
+		} else if key := p.text(base, k); key != nil {
+			var val = p.text(base, v)
+			if val == nil { val = _null(key.Pos()) }
+			u.configSet = append(u.configSet, &pair{key, val})
+		}
+	}
+	for _, s := range configUnset {
+		if v := p.text(base, s); v != nil { u.configUnset = append(u.configUnset, v) }
+	}
 
     if v := u.fastMode; v { // Turn off many things for fast mode:
         //l.noImportFiles = v
@@ -20655,6 +21526,35 @@ func (p *compiler) parseArgs(ctx Context, a []string) {
         u.noGrep = v
     }
 
+    u.vmdebug.trace, u.vmdebug.step = u.debugVM || u.debugVMStep, u.debugVMStep
+    if u.vmdebug.trace { vmdebugging.Store(true) }
+
+    var ctl = u.diagnostic.ctl
+    ctl.maxErros = u.maxErrors
+    ctl.warns.Lock()
+    ctl.warns.werror = u.werror
+    for _, v := range merge(u.noWarn...) {
+        if ctl.warns.disabled == nil { ctl.warns.disabled = make(map[warncat]bool) }
+        ctl.warns.disabled[warncat(__string(ctx, v))] = true
+    }
+    ctl.warns.Unlock()
+
+    switch u.diagFormat {
+    case "":
+    case "json", "sarif":
+        ctl.format.name = u.diagFormat
+        if ctl.format.close(); u.diagOutput == "" {
+        } else if f, err := os.Create(u.diagOutput); err != nil {
+            erro(ctx, "-diag-output: %v", err)
+        } else {
+            ctl.format.Lock()
+            ctl.format.out, ctl.format.file = f, f
+            ctl.format.Unlock()
+        }
+    default:
+        erro(ctx, "-diag-format: unknown format %s (json, sarif)", u.diagFormat)
+    }
+
     var mode = new(word)
 
 	for _, target := range args {
@@ -21127,6 +22027,25 @@ func (c configure_ctx) do(ctx Context, op any) any {
 	return c.Context.do(ctx, op)
 }
 
+// configprobe records where a configure entry is produced and the probes
+// (configure handlers) evaluating it.
+type configprobe struct {
+	pos    Pos
+	ops    []Symbol // e.g. `headers-c` for `-headers-c`
+	pinned bool     // set by -config-set, never probed again
+}
+
+func (p *project) probe(name Symbol) (c *configprobe) {
+	if p.probes == nil {
+		p.probes = make(map[Symbol]*configprobe)
+	} else if c = p.probes[name]; c != nil {
+		return
+	}
+	c = new(configprobe)
+	p.probes[name] = c
+	return
+}
+
 func (p *compiler) configure_def(ctx Context, name Symbol, vals ...Value) (d *def, isNew bool) {
 	if false && checkpoints { debug(ctx, "configure: %v => %v", name, vals) }
 	if d, isNew, _ = p.project._def(ctx, defConfig, name, vals...); d != nil && isNew {
@@ -21354,14 +22273,43 @@ func (p *compiler) configure_handle(exe *execution, op Symbol, val Value, args [
 	return finalRes
 }
 
+// hoist_flag_args hoists trailing arguments (or value) of a flag, the parser
+// yields `-headers-c(x)` as -(headers -c(x)), it's turned into (-headers-c)(x),
+// likewise `-junit-xml=x` into (-junit-xml)=x.
+func hoist_flag_args(v Value) Value {
+	var strip func(v Value) (Value, func(Value) Value)
+	strip = func(v Value) (Value, func(Value) Value) {
+		switch t := v.(type) {
+		case *argumented:
+			return t.Value, func(x Value) Value { return &argumented{x, t.args} }
+		case *pair:
+			return t.key, func(x Value) Value { return &pair{x, t.val} }
+		case flag:
+			if x, f := strip(t.Value); f != nil { return flag{x}, f }
+		case *compound:
+			if n := len(t.elems); n > 0 {
+				if x, f := strip(t.elems[n-1]); f != nil {
+					return &compound{elements{append(dup(t.elems[:n-1]), x)}}, f
+				}
+			}
+		}
+		return v, nil
+	}
+	if t, ok := v.(flag); ok {
+		if x, f := strip(t.Value); f != nil { return f(flag{x}) }
+	}
+	return v
+}
+
 func (p *compiler) configure_clause(exe *execution, ids []Value) {
 	var handlers []configure_handler
 	var _no_cond bool
 	var silent bool
+	var pinned bool
 
 minusloop:
 	for p.tok == MINUS {
-		v := p.expr()
+		v := hoist_flag_args(p.expr())
 		p.spaces()
 
 		switch t := v.(type) {
@@ -21396,6 +22344,8 @@ minusloop:
 				erro(pc(p,t.Pos()), "configure cond without value", callstack{num:5})
 			} else if sym == symSilent {
 				silent = true
+			} else if sym == symPinned {
+				pinned = true // pinned by -config-set, see configuration.sm
 			} else {
 				handlers = append(handlers, configure_handler{op: sym})
 			}
@@ -21445,6 +22395,15 @@ minusloop:
 			d.value = nil
 		}
 
+		probe := p.project.probe(sym)
+		if pinned {
+			probe.pinned = true
+		} else if len(handlers) > 0 {
+			probe.ops = nil
+			for _, h := range handlers { probe.ops = append(probe.ops, h.op) }
+		}
+		if !probe.pinned || pinned { probe.pos = id.Pos() } // pinned values retain the origin
+
 		if checkpoints {
 			p.check_configure_cache(exe, d, isNew, isCached, false)
 			defer p.check_configure_cache(exe, d, isNew, true, true)
@@ -21463,6 +22422,15 @@ minusloop:
 			val := ease(p, p.values())
 			p.Context = snap_ctx
 
+			if isCached && probe.pinned && !pinned {
+				if p.promptCachedConfigs() {
+					prompt(p, "%v:info: pinned %v\n", do(p, get_fatpos{d.pos}), d)
+					flush(p)
+				}
+				p.lineComment = nil
+				continue
+			}
+
 			if isCached && equal(p, d.value, val) {
 				if p.promptCachedConfigs() {
 					prompt(p, "%v:info: cached %v\n", do(p, get_fatpos{d.pos}), d)
@@ -23581,7 +24549,9 @@ func (p *url) String() (s string) {
     if p.Host != nil {
         s += "//"
         if p.Username != nil {
-            s += p.Username.String() + "@"
+            s += p.Username.String()
+            if p.Password != nil { s += ":" + p.Password.String() }
+            s += "@"
         }
         s += p.Host.String()
         if p.Port != nil {
@@ -23592,22 +24562,86 @@ func (p *url) String() (s string) {
         s += p.Path.String()
     }
     if p.Query != nil {
-        s += "?"
-        for i, q := range p.Query {
-            if 0 < i { s += "&" }
-            s += q.String()
-        }
+        s += "?" + p.rawQuery()
     }
     if p.Fragment != nil {
         s += "#" + p.Fragment.String()
     }
     return
 }
+
+// rawQuery joins the query components, escaping the keys and values
+// unescaped by parseUrlQuery.
+func (p *url) rawQuery() string {
+    var a []string
+    for _, q := range p.Query {
+        if t, ok := q.(*pair); ok {
+            a = append(a, neturl.QueryEscape(t.key.String())+"="+neturl.QueryEscape(t.val.String()))
+        } else {
+            a = append(a, neturl.QueryEscape(q.String()))
+        }
+    }
+    return strings.Join(a, "&")
+}
+
+// Validate builds the net/url URL from the components, the user info is
+// set only if there's a username (keeping the password).
 func (p *url) Validate() (res *neturl.URL) {
-    panic(fmt.Sprintf("validate %s", p))
+    if p.Scheme == nil { return }
+    res = &neturl.URL{ Scheme: p.Scheme.String() }
+    if p.Username != nil {
+        if p.Password != nil {
+            res.User = neturl.UserPassword(p.Username.String(), p.Password.String())
+        } else {
+            res.User = neturl.User(p.Username.String())
+        }
+    }
+    if p.Host != nil {
+        res.Host = p.Host.String()
+        if strings.Contains(res.Host, ":") { res.Host = "["+res.Host+"]" } // IPv6
+        if p.Port != nil && p.Port.String() != "" { res.Host += ":" + p.Port.String() }
+    }
+    if p.Path != nil { res.Path = p.Path.String() }
+    if p.Query != nil { res.RawQuery = p.rawQuery() }
+    if p.Fragment != nil { res.Fragment = p.Fragment.String() }
     return
 }
 
+// sel selects url components, e.g. $(u->host), $(u->query), $(u->query.key).
+func (p *url) sel(ctx Context, s Symbol) Value {
+    var name, rest = s, symEmpty
+    if ss := __symSplit(s, symDot); len(ss) > 1 {
+        name, rest = ss[0], __symJoinBy(symDot, ss[1:]...)
+    }
+    var v Value
+    switch name {
+    case symScheme:            v = p.Scheme
+    case symUser, symUsername: v = p.Username
+    case symPassword:          v = p.Password
+    case symHost:              v = p.Host
+    case symPort:              v = p.Port
+    case symPath:              v = p.Path
+    case symFragment:          v = p.Fragment
+    case symQuery:
+        if rest == symEmpty {
+            if p.Query == nil { return nil }
+            return &list{elements{p.Query}}
+        }
+        var vals []Value
+        for _, q := range p.Query {
+            if t, ok := q.(*pair); ok && __symbol(ctx, t.key) == rest {
+                vals = append(vals, t.val)
+            }
+        }
+        if len(vals) == 0 { return nil }
+        return ease(ctx, vals)
+    default:
+        return nil
+    }
+    if rest != symEmpty { return sel(ctx, v, rest) }
+    return v
+}
+
 type raw struct{ valbase; s string }
 func (_ *raw) kind() Kind { return KindRaw }
 func (p *raw) String() string { return /* "{raw "+p.s+"}" */p.s }
@@ -26505,6 +27539,10 @@ func sel(ctx Context, v any, s Symbol) Value {
 	case  *loc: return sel(ctx, t.Value, s)
 	case *list: return sel(ctx, t.elems, s)
 	case *project: return t.resolve(ctx, s)
+	case *url: return t.sel(ctx, s)
+	case *pair:
+		if __symbol(ctx, t.key) == s { return t.val }
+		return nil
 	case self:
 		if o := t.resolve(ctx, s); o != nil { return &loc{o, t.pos} }
 		return nil // Gracefully pass nil back to the safe-navigation logic!
@@ -27256,6 +28294,25 @@ type std_writer struct {
     suffixDots bool
 }
 
+var redirected sync.Mutex
+
+// redirect sends stdout and stderr to the writers (nil keeps the current one)
+// until the returned func is called, redirections are serialized.
+func redirect(o, e io.Writer) (restore func()) {
+    redirected.Lock()
+    stdout.Lock(); stderr.Lock()
+    var savedStdout, savedStderr = stdout.io, stderr.io
+    if o != nil { stdout.io = o }
+    if e != nil { stderr.io = e }
+    stderr.Unlock(); stdout.Unlock()
+    return func() {
+        stdout.Lock(); stderr.Lock()
+        stdout.io, stderr.io = savedStdout, savedStderr
+        stderr.Unlock(); stdout.Unlock()
+        redirected.Unlock()
+    }
+}
+
 func (w *std_writer) Write(p []byte) (n int, err error) {
     w.Lock()
     if w.suffixDots {
@@ -27305,6 +28362,605 @@ func (p *exec_log) newWriter(file *os.File, dir, cmd string) {
     fmt.Fprintf(p, "%s\n", cmd)
 }
 
+// usermatcher is a tool matcher declared by $(matcher) in .smart files,
+// it scans recipe output next to the built-in knownerrors table.
+type usermatcher struct {
+    name    warncat // warning category, see -no-warn
+    cmd, rx *regexp.Regexp
+    level   diagtype
+    severity, file, line, column, message int // capture indexes
+    stdout  bool
+}
+
+// usermatchers are the $(matcher) declarations of a universe, evaluating
+// a declaration again (reloads) doesn't add it twice (see seen).
+type usermatchers struct {
+    sync.Mutex
+    list []*usermatcher
+    seen map[string]bool // position and line regex
+}
+
+func (ms *usermatchers) add(pos Position, m *usermatcher) {
+    ms.Lock(); defer ms.Unlock()
+    var key = pos.String() + " " + m.rx.String()
+    if ms.seen == nil { ms.seen = make(map[string]bool) }
+    if ms.seen[key] { return }
+    ms.seen[key] = true
+    ms.list = append(ms.list, m)
+}
+
+func (ms *usermatchers) match(cmd string) (res []*usermatcher) {
+    ms.Lock(); defer ms.Unlock()
+    for _, m := range ms.list {
+        if m.cmd.MatchString(cmd) { res = append(res, m) }
+    }
+    return
+}
+
+func (m *usermatcher) report(ctx Context, p *exec_buffer, line []byte, sm [][]byte) {
+    sub := func(i int) string {
+        if 0 < i && i < len(sm) { return string(sm[i]) }
+        return ""
+    }
+
+    pos := p.logPos(0)
+    if s := sub(m.file); s != "" {
+        pos = p.makePos(s, sub(m.line), sub(m.column))
+    }
+
+    msg := sub(m.message)
+    if msg == "" { msg = strings.TrimSpace(string(sm[0])) }
+
+    level := m.level
+    switch s := strings.ToLower(sub(m.severity)); {
+    case s == "": // -level
+    case strings.Contains(s, "error"), strings.Contains(s, "fatal"): level = diagError
+    case strings.Contains(s, "warn"): level = diagWarn
+    case strings.Contains(s, "note"), strings.Contains(s, "info"), strings.Contains(s, "remark"): level = diagInfo
+    }
+
+    ctx = pc(ctx, pos)
+    s := _f("%s {\n%s\n}", msg, strings.TrimRight(string(line), "\r\n"))
+    switch level {
+    case diagError: erro(ctx, s, trace_ctx{50}, callstack{num: 3})
+    case diagWarn:  warn(ctx, s, m.name, trace_ctx{50}, callstack{num: 3})
+    default:        info(ctx, s)
+    }
+}
+
+// sandboxToolDirs are exposed (read-only) to sandboxed recipes, see -sandbox.
+var sandboxToolDirs = []string{ "/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt" }
+
+var rxSandboxNoSuchFile = regexp.MustCompile(`([^\s:'"‘]+)['’]?: [Nn]o such file or directory`)
+
+// sandboxArgs returns the helper (bubblewrap) arguments which expose only
+// the tool dirs and the declared prerequisites ($^, $| and grepped files,
+// all read-only) to the recipe. The target's directory is replaced by a
+// writable scratch directory, see sandboxDone.
+func (ctx *exec_ctx) sandboxArgs(exe *execution, cmd string) (args []string, scratch, target string) {
+    var u = _universe(ctx)
+    var seen = make(map[string]bool)
+    var bind = func(opt, s string) {
+        if s = filepath.Clean(s); s != "" && s != "/" && !seen[s] {
+            seen[s] = true
+            args = append(args, opt, s, s)
+        }
+    }
+    var workdir = exe.workdir.String()
+    if tf, ok := ctx.target.(*file); ok && tf != nil {
+        target = tf.fullname().String()
+    } else if s := ctx.targetName; s != symEmpty && !__symIsAbs(s) {
+        target = filepath.Join(workdir, s.String())
+    } else if s != symEmpty {
+        target = s.String()
+    }
+
+    var dir = workdir
+    if target != "" { dir = filepath.Dir(target) }
+    if e := os.MkdirAll(dir, 0755); e != nil {
+        erro(ctx, "-sandbox: %v", e, unwind{})
+    } else if scratch, e = os.MkdirTemp(dir, ".sandbox-"); e != nil {
+        erro(ctx, "-sandbox: %v", e, unwind{})
+    } else if target != "" {
+        if e = sandboxTarget(scratch, target); e != nil { erro(ctx, "-sandbox: %v", e, unwind{}) }
+    }
+
+    args = append(args, "--die-with-parent", "--unshare-all",
+        "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp",
+        "--dir", dir, "--bind", scratch, dir, "--dir", workdir)
+    seen[filepath.Clean(dir)] = true
+    for _, s := range sandboxToolDirs { bind("--ro-bind-try", s) }
+    for _, s := range filepath.SplitList(os.Getenv("PATH")) {
+        if filepath.IsAbs(s) { bind("--ro-bind-try", s) }
+    }
+    if filepath.IsAbs(cmd) { bind("--ro-bind-try", filepath.Dir(cmd)) }
+    for _, v := range merge(u.sandboxAllow...) { bind("--ro-bind-try", ctx.depPath(exe, v)) }
+
+    var deps = merge(auto_get(ctx, symCaret), auto_get(ctx, symBar))
+    for _, v := range append(deps, exe.grepped...) {
+        if v != nil && !isNull(v) { bind("--ro-bind-try", ctx.depPath(exe, v)) }
+    }
+    return append(args, "--chdir", workdir), scratch, target
+}
+
+var sandboxLink = os.Link // see sandboxTarget
+
+// sandboxTarget puts the existing target into the scratch directory as it
+// may be updated in place (e.g. ar), it's linked or else copied (e.g. EXDEV)
+// with its mode and mtime.
+func sandboxTarget(scratch, target string) (err error) {
+    var s = filepath.Join(scratch, filepath.Base(target))
+    if err = sandboxLink(target, s); err == nil || os.IsNotExist(err) { return nil }
+
+    var fi os.FileInfo
+    if fi, err = os.Stat(target); os.IsNotExist(err) { return nil } else if err != nil { return }
+    var f *os.File
+    if f, err = os.OpenFile(s, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm()); err != nil { return }
+    if err = copyFileTo(f, target); err != nil {
+        f.Close()
+    } else if err = f.Close(); err == nil {
+        err = os.Chtimes(s, fi.ModTime(), fi.ModTime())
+    }
+    return
+}
+
+// sandboxDone moves the target built in the scratch directory into place
+// and removes the scratch directory, other files written are dropped.
+func (ctx *exec_ctx) sandboxDone(scratch, target string, built bool) {
+    defer os.RemoveAll(scratch)
+    if !built || target == "" { return }
+    var s = filepath.Join(scratch, filepath.Base(target))
+    if _, err := os.Lstat(s); err != nil {
+        return // not written
+    } else if err = os.Rename(s, target); err != nil {
+        erro(ctx, "-sandbox: %v", err)
+    }
+}
+
+// dryRunHeader prints what -dry-run shows before the expanded recipes: the
+// target and why it's outdated, the dialect, the working directory and
+// the (env) overrides.
+func (ctx *exec_ctx) dryRunHeader(exe *execution, cmd string, env []string) {
+    var b bytes.Buffer
+    var dialect = ctx.dialect.String()
+    if dialect == "" { dialect = cmd }
+    fmt.Fprintf(&b, "# %s", trimPrompt(ctx.targetName.String()))
+    if s := exe.dirt; s != "" { fmt.Fprintf(&b, " …… %s", s) }
+    fmt.Fprintf(&b, "\n# (%s) in %s\n", dialect, exe.workdir)
+    for _, s := range env {
+        if k := strings.Index(s, "="); k > 0 {
+            fmt.Fprintf(&b, "# %s%s\n", s[:k+1], strconv.Quote(s[k+1:]))
+        }
+    }
+    stdout.Write(b.Bytes())
+}
+
+// dryModifier tells if a modifier which writes files is to be skipped
+// (-n, -no-exec), with -n it prints what would be done next to the recipes.
+func dryModifier(ctx Context, name, f string, a ...any) bool {
+    if !truly(ctx, exec_noop{}) { return false }
+    if _universe(ctx).dryRun { fmt.Fprintf(stdout, "# (%s) %s\n", name, fmt.Sprintf(f, a...)) }
+    return true
+}
+
+// deleteOnError tells if the failed (or interrupted) target is to be
+// removed, see (shell -remove-on-fail), -delete-on-error and (precious).
+func (ctx *exec_ctx) deleteOnError() bool {
+    if f, ok := to_file(ctx.target); ok && f != nil {
+        if p := _project(ctx); p != nil && p.precious(ctx, f) { return false }
+    }
+    var u = _universe(ctx)
+    return ctx.removeOnFail || u.deleteOnError || (u.runctx != nil && u.runctx.Err() != nil)
+}
+
+// depPath returns the full path of a prerequisite.
+func (ctx *exec_ctx) depPath(exe *execution, v Value) string {
+    if f, ok := to_file(v); ok { return f.fullname().String() }
+    if s := __string(ctx, v); s == "" || filepath.IsAbs(s) {
+        return s
+    } else {
+        return filepath.Join(exe.workdir.String(), s)
+    }
+}
+
+// wrap runs ctx.sh in the helper (-sandbox, -trace-inputs).
+func (ctx *exec_ctx) wrap(helper string, args []string) {
+    var cmd = ctx.sh.Path
+    if ctx.sh.Err != nil { cmd = ctx.sh.Args[0] }
+    ctx.sh.Path, ctx.sh.Err = helper, nil
+    ctx.sh.Args = append(append(append([]string{helper}, args...), "--", cmd), ctx.sh.Args[1:]...)
+}
+
+// sandboxUndeclared reports files a sandboxed recipe failed to read which
+// exist on the host, i.e. the undeclared dependencies.
+func sandboxUndeclared(ctx Context, p *exec_buffer, line []byte, sm [][]byte) {
+    var s = p.filepath(string(sm[1]))
+    if _, err := os.Stat(s); err == nil {
+        col := bytes.Index(line, sm[1]) + 1
+        erro(pc(ctx, p.logPos(col)), _f("undeclared dependency '%s' (-sandbox) {\n%s\n}", s, strings.TrimRight(string(line), "\r\n")), trace_ctx{50}, callstack{num: 3})
+    }
+}
+
+// traceArgs returns the -trace-inputs helper (strace) arguments, each
+// traced process logs to prefix.PID, fds are printed with their paths (-y).
+func traceArgs(prefix string) []string {
+    return []string{"-f", "-ff", "-qq", "-y", "-s", "4096", "-o", prefix,
+        "-e", "trace=open,openat,openat2,creat,execve,chdir,fchdir,clone,clone3,fork,vfork"}
+}
+
+var (
+    rxTraceOpen = regexp.MustCompile(`^(?:\d+\s+)?(open|openat|openat2|creat|execve)\((?:([^,"]*), )?("(?:[^"\\]|\\.)*")(.*)\)\s+= (\d+)`)
+    rxTraceChdir = regexp.MustCompile(`^(?:\d+\s+)?(?:chdir\(("(?:[^"\\]|\\.)*")|fchdir\(\d+<(.*)>)\)\s+= 0`)
+    rxTraceFork = regexp.MustCompile(`^(?:\d+\s+)?(?:clone3?|v?fork)\(.*\)\s+= (\d+)`)
+)
+
+// traceInputs parses (and removes) the -trace-inputs logs and returns the
+// files successfully opened for reading (or executed) but never written.
+// Relative names are resolved in the directory of the fd (openat) or of
+// the process, which starts in workdir or the parent's directory at the
+// fork and follows chdir and fchdir.
+func traceInputs(prefix, workdir string) (inputs []string) {
+    var logs, _ = filepath.Glob(prefix + ".*")
+    var lines = make(map[int][]string) // by pid
+    var roots []int
+    var forked = make(map[int]bool)
+    for _, log := range logs {
+        pid, err := strconv.Atoi(strings.TrimPrefix(log, prefix + "."))
+        data, e := os.ReadFile(log)
+        if os.Remove(log); err != nil || e != nil { continue }
+        lines[pid] = strings.Split(string(data), "\n")
+        for _, line := range lines[pid] {
+            if m := rxTraceFork.FindStringSubmatch(line); m != nil {
+                if n, err := strconv.Atoi(m[1]); err == nil { forked[n] = true }
+            }
+        }
+    }
+    for pid := range lines {
+        if !forked[pid] { roots = append(roots, pid) }
+    }
+    sort.Ints(roots)
+
+    var read, written = make(map[string]bool), make(map[string]bool)
+    var trace func(pid int, cwd string)
+    trace = func(pid int, cwd string) {
+        var log = lines[pid]
+        delete(lines, pid) // once
+        for _, line := range log {
+            if m := rxTraceFork.FindStringSubmatch(line); m != nil {
+                if n, err := strconv.Atoi(m[1]); err == nil { trace(n, cwd) }
+                continue
+            } else if m := rxTraceChdir.FindStringSubmatch(line); m != nil {
+                var s = m[2]
+                if m[1] != "" { s, _ = strconv.Unquote(m[1]) }
+                if s == "" { continue } else if !filepath.IsAbs(s) { s = filepath.Join(cwd, s) }
+                cwd = filepath.Clean(s)
+                continue
+            }
+
+            var m = rxTraceOpen.FindStringSubmatch(line)
+            if m == nil { continue }
+            var s, err = strconv.Unquote(m[3])
+            if err != nil || s == "" { continue }
+            if filepath.IsAbs(s) {
+            } else if i := strings.IndexByte(m[2], '<'); i > 0 && strings.HasSuffix(m[2], ">") {
+                s = filepath.Join(m[2][i+1:len(m[2])-1], s) // openat(3</dir>, ...)
+            } else {
+                s = filepath.Join(cwd, s)
+            }
+            switch s, flags := filepath.Clean(s), m[4]; {
+            case m[1] == "creat", strings.Contains(flags, "O_WRONLY"),
+                strings.Contains(flags, "O_RDWR"), strings.Contains(flags, "O_CREAT"):
+                written[s] = true
+            case strings.Contains(flags, "O_DIRECTORY"): // listing
+            case !read[s]:
+                read[s] = true
+                inputs = append(inputs, s)
+            }
+        }
+    }
+    for _, pid := range roots { trace(pid, workdir) }
+
+    var n int
+    for _, s := range inputs {
+        if !written[s] { inputs[n] = s; n++ }
+    }
+    return inputs[:n]
+}
+
+// traceUndeclared warns about the traced inputs which are neither the
+// prerequisites ($^, $|) nor grepped (including the cached grep closure of
+// the prerequisites) nor in the tool dirs, or records them (see
+// -trace-inputs-record) to be traversed by the next runs.
+func (ctx *exec_ctx) traceUndeclared(exe *execution, inputs []string) {
+    var declared = make(map[string]bool)
+    var todo = append(merge(auto_get(ctx, symCaret), auto_get(ctx, symBar)), exe.grepped...)
+    grepcacheM.Lock()
+    for len(todo) > 0 {
+        var v = todo[len(todo)-1]
+        if todo = todo[:len(todo)-1]; v == nil || isNull(v) { continue }
+        if s := ctx.depPath(exe, v); s == "" || declared[s] { continue } else {
+            declared[s] = true
+        }
+        if f, ok := to_file(v); ok {
+            for _, e := range grepcache[f.fullname()] { todo = append(todo, e.files...) }
+        }
+    }
+    grepcacheM.Unlock()
+
+    var ignored = append([]string{"/proc", "/dev", "/sys"}, sandboxToolDirs...)
+    ignored = append(ignored, filepath.SplitList(os.Getenv("PATH"))...)
+    if tf, ok := ctx.target.(*file); ok && tf != nil {
+        declared[tf.fullname().String()] = true
+    }
+
+    var undeclared []string
+ForInputs:
+    for _, s := range inputs {
+        if declared[s] { continue }
+        for _, d := range ignored {
+            if d = filepath.Clean(d); d != "." && d != "/" && (s == d || strings.HasPrefix(s, d+"/")) {
+                continue ForInputs
+            }
+        }
+        if fi, err := os.Stat(s); err == nil && fi.Mode().IsRegular() {
+            undeclared = append(undeclared, s)
+        }
+    }
+
+    if len(undeclared) == 0 {
+        // all declared
+    } else if !_universe(ctx).traceRecord {
+        for _, s := range undeclared {
+            warn(ctx, "undeclared input '%s' (-trace-inputs)", s, warncat("inputs"))
+        }
+    } else if name := tracedInputsFileName(ctx); name != symEmpty {
+        var seen = make(map[string]bool)
+        if data, err := os.ReadFile(name.String()); err == nil {
+            for _, s := range strings.Split(string(data), "\n") {
+                if s != "" { seen[s] = true }
+            }
+        }
+        for _, s := range undeclared { seen[s] = true }
+        var lines = make([]string, 0, len(seen))
+        for s := range seen { lines = append(lines, s+"\n") }
+        sort.Strings(lines)
+
+        if err := os.MkdirAll(__symDir(name).String(), os.FileMode(0755)); err != nil {
+            erro(ctx, "%v", err)
+        } else if err = os.WriteFile(name.String(), []byte(strings.Join(lines, "")), os.FileMode(0666)); err != nil {
+            erro(ctx, "save inputs file failed: %v", err)
+        } else {
+            debug(ctx, "recorded %d inputs (%s)", len(undeclared), name)
+        }
+    }
+}
+
+// tracedInputsFileName returns the .inputs cache file of the target, see
+// -trace-inputs-record.
+func tracedInputsFileName(ctx Context) (filename Symbol) {
+    if _, sym := auto_target_valsym(ctx); sym == symEmpty {
+        // no target
+    } else if proj := _project(ctx); proj == nil {
+        // no project
+    } else if file, err := proj.cachefileHash(ctx, ".inputs", sym.String()); err != nil {
+        erro(ctx, "get .inputs cache file failed: %v", err)
+    } else {
+        filename = file.fullname()
+    }
+    return
+}
+
+// tracedInputs traverses the inputs recorded by -trace-inputs-record just
+// like the grepped files.
+func (p *execution) tracedInputs() {
+    if u := _universe(p); u.noDeps { return }
+    var name = tracedInputsFileName(p)
+    if name == symEmpty { return }
+    if f := _stat(p, name); f == nil || !f.exists() { return }
+    data, err := os.ReadFile(name.String())
+    if err != nil {
+        erro(p, "can't open inputs file: %v", err)
+        return
+    }
+    for _, s := range strings.Split(string(data), "\n") {
+        if s == "" { continue }
+        if f := _stat(p, intern(s)); f != nil && f.exists() {
+            traverse(p, f)
+            p.grepped = append(p.grepped, f)
+        }
+    }
+}
+
+// jobserver is the GNU make jobserver (a fifo or a pipe of tokens) which
+// shares the -jobs slots with the children (make, ninja, cargo, smart, ...)
+// via MAKEFLAGS, it's inherited if smart is run by make (see -jobs), each
+// universe has its own (see startJobserver).
+type jobserver struct {
+    sync.Mutex
+    r, w *os.File
+    fifo string // the fifo path, or empty for a pipe
+    owned bool // created by this smart
+    slots int
+    busy int // running jobs, the first takes the implicit slot
+}
+
+var rxJobserverAuth = regexp.MustCompile(`^--jobserver-(?:auth|fds)=(.+)$`)
+
+// parseMakeflags returns the jobserver auth (fifo:PATH or R,W), the -j
+// slots and the other flags of MAKEFLAGS.
+func parseMakeflags(s string) (auth string, slots int, rest []string) {
+    for _, f := range strings.Fields(s) {
+        if m := rxJobserverAuth.FindStringSubmatch(f); m != nil {
+            auth = m[1] // the last one wins
+        } else if strings.HasPrefix(f, "-j") && len(f) > 2 {
+            if n, err := strconv.Atoi(f[2:]); err == nil { slots = n }
+        } else {
+            rest = append(rest, f)
+        }
+    }
+    return
+}
+
+func parseJobserverFds(auth string) (r, w uintptr, ok bool) {
+    var n, err = fmt.Sscanf(auth, "%d,%d", &r, &w)
+    return r, w, err == nil && n == 2 && r > 0 && w > 0
+}
+
+// startJobserver joins the jobserver of MAKEFLAGS (as a client), or creates
+// one for -jobs=N (N > 1) which is removed by the returned func.
+func startJobserver(u *universe) (stop func()) {
+    stop = func() {}
+    var jobserver = &u.jobserver
+    jobserver.Lock()
+    defer jobserver.Unlock()
+
+    if auth, slots, _ := parseMakeflags(os.Getenv("MAKEFLAGS")); auth == "" {
+        // not run by make (or make -j1)
+    } else if u.jobs > 0 {
+        warn(u, "-jobs=%d forced, ignoring the jobserver of MAKEFLAGS", u.jobs)
+    } else if path, isFifo := strings.CutPrefix(auth, "fifo:"); isFifo {
+        if f, err := os.OpenFile(path, os.O_RDWR, 0); err != nil {
+            warn(u, "jobserver %s unavailable: %v", auth, err)
+        } else {
+            jobserver.r, jobserver.w, jobserver.fifo, jobserver.slots = f, f, path, slots
+        }
+    } else if r, w, ok := parseJobserverFds(auth); !ok {
+        warn(u, "jobserver %s unsupported", auth)
+    } else if fr, fw := os.NewFile(r, "jobserver-r"), os.NewFile(w, "jobserver-w"); fr == nil || fw == nil {
+        warn(u, "jobserver %s unavailable", auth)
+    } else if _, err := fr.Stat(); err != nil {
+        warn(u, "jobserver %s unavailable: %v", auth, err)
+    } else {
+        jobserver.r, jobserver.w, jobserver.slots = fr, fw, slots
+    }
+    if jobserver.r != nil || u.jobs < 2 { return }
+
+    var err error
+    switch u.jobserverStyle {
+    case "", "fifo":
+        var path = filepath.Join(os.TempDir(), fmt.Sprintf("smart-jobserver-%d-%p", os.Getpid(), u))
+        if err = syscall.Mkfifo(path, 0600); err == nil {
+            if jobserver.r, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+                os.Remove(path)
+            } else {
+                jobserver.w, jobserver.fifo = jobserver.r, path
+            }
+        }
+    case "pipe":
+        jobserver.r, jobserver.w, err = os.Pipe()
+    default:
+        err = fmt.Errorf("unknown style '%s' (fifo, pipe)", u.jobserverStyle)
+    }
+    if err != nil {
+        erro(u, "jobserver: %v", err)
+        return
+    }
+
+    jobserver.owned, jobserver.slots = true, u.jobs
+    jobserver.w.Write(bytes.Repeat([]byte{'+'}, u.jobs-1))
+    return func() {
+        jobserver.Lock()
+        defer jobserver.Unlock()
+        if jobserver.r != nil { jobserver.r.Close() }
+        if jobserver.w != nil && jobserver.w != jobserver.r { jobserver.w.Close() }
+        if jobserver.fifo != "" { os.Remove(jobserver.fifo) }
+        jobserver.r, jobserver.w, jobserver.fifo = nil, nil, ""
+    }
+}
+
+// jobserverCmd passes the jobserver to the child via MAKEFLAGS (and the
+// pipe as fds 3 and 4).
+func jobserverCmd(ctx Context, c *exec.Cmd) {
+    var jobserver = &_universe(ctx).jobserver
+    jobserver.Lock()
+    defer jobserver.Unlock()
+    if jobserver.r == nil { return }
+
+    var flags string
+    var env = c.Env
+    if env == nil { env = os.Environ() }
+    for i := len(env) - 1; i >= 0; i-- {
+        if k := strings.Index(env[i], "="); k > 0 && env[i][:k] == "MAKEFLAGS" {
+            if flags == "" { flags = env[i][k+1:] }
+            env = append(env[:i], env[i+1:]...)
+        }
+    }
+
+    var _, _, rest = parseMakeflags(flags)
+    if jobserver.slots > 0 { rest = append(rest, fmt.Sprintf("-j%d", jobserver.slots)) }
+    if jobserver.fifo != "" {
+        rest = append(rest, "--jobserver-auth=fifo:"+jobserver.fifo)
+    } else {
+        var n = 3 + len(c.ExtraFiles)
+        c.ExtraFiles = append(c.ExtraFiles, jobserver.r, jobserver.w)
+        rest = append(rest, fmt.Sprintf("--jobserver-auth=%d,%d", n, n+1))
+    }
+    c.Env = append(env, "MAKEFLAGS= "+strings.Join(rest, " "))
+}
+
+// acquireJob takes a jobserver slot for running a recipe, the first job
+// takes the implicit slot of smart, others wait for a token.
+func acquireJob(ctx Context) (release func()) {
+    var jobserver = &_universe(ctx).jobserver
+    jobserver.Lock()
+    if jobserver.r == nil {
+        jobserver.Unlock()
+        return func() {}
+    } else if jobserver.busy++; jobserver.busy == 1 {
+        jobserver.Unlock()
+        return func() { jobserver.Lock(); jobserver.busy--; jobserver.Unlock() }
+    }
+    var r, w = jobserver.r, jobserver.w
+    jobserver.Unlock()
+
+    var token = []byte{'+'}
+    if _, err := r.Read(token); err != nil {
+        token = nil // the jobserver is gone
+    }
+    return func() {
+        if token != nil { w.Write(token) }
+        jobserver.Lock(); jobserver.busy--; jobserver.Unlock()
+    }
+}
+
+// jobslot is the jobserver slot held by a traversal worker (see schedule),
+// the recipes and (fork)s it traverses run in it.
+type jobslot struct{ release func() }
+type held_job struct{}
+type job_ctx struct {
+    Context
+    slot *jobslot
+    mu *sync.Mutex // shared by the workers, for the results to the caller
+}
+func (c *job_ctx) do(ctx Context, op any) any {
+    switch t := op.(type) {
+    case inner_cast: return c.Context
+    case dynamic_cast: return t.ctx(c, c.Context)
+    case held_job: return c.slot
+    case program_res, default_value:
+        c.mu.Lock()
+        defer c.mu.Unlock()
+    }
+    return c.Context.do(ctx, op)
+}
+
+// jobToken takes a jobserver slot for running a child (a recipe or a
+// (fork)), unless it's run in the slot of a traversal worker.
+func jobToken(ctx Context) (release func()) {
+    if s, _ := do(ctx, held_job{}).(*jobslot); s != nil { return func() {} }
+    return acquireJob(ctx)
+}
+
+// jobWorkers is the number of traversal workers, the jobserver slots or
+// maxWorkers.
+func jobWorkers(ctx Context) int {
+    var jobserver = &_universe(ctx).jobserver
+    jobserver.Lock()
+    defer jobserver.Unlock()
+    if jobserver.r != nil && jobserver.slots > 0 { return jobserver.slots }
+    return maxWorkers
+}
+
 type exec_buffer struct {
     xc *exec_ctx // only if executing
 
@@ -27405,6 +29061,8 @@ func (p *exec_buffer) Write(b []byte) (n int, err error) {
 
             for rx, f := range commonerrors { k(rx, f) }
             for rx, f := range p.xc.known { k(rx, f) }
+            for _, m := range p.xc.matchers { k(m.rx, m.report) }
+            if p.xc.sandboxed { k(rxSandboxNoSuchFile, sandboxUndeclared) }
 
 			if checkpoints && knownErrs == 0 {
 				var missed bool
@@ -27510,6 +29168,9 @@ type exec_ctx struct {
 	// TODO: commonerrors int
 	// TODO: knownerrors int
     known map[*regexp.Regexp]func(Context, *exec_buffer, []byte, [][]byte)
+    matchers []*usermatcher
+    sandboxed bool // -sandbox
+    dialect Symbol // shell, python, perl, dock
 
     start time_pkg.Time
 
@@ -27645,7 +29306,9 @@ func (p *exec_ctx) run(exe *execution) (err error) {
 
     run := func(c *exec.Cmd) {
         defer exe.Done()
+        defer jobToken(exe)()
 
+        jobserverCmd(exe, c)
         err = c.Run();
 
         if err == nil {
@@ -27720,7 +29383,7 @@ func (p *exec_ctx) check() (err error) {
         var diffLogPos = !p.logPos.sameLine(pos)
         var str, _, _ = entryIndicator(ctx, _entry(ctx))
         if (/* !p.retStatus && */ p.status != 0) || en > 0 {
-            if !(checkpoints && keepTempfileForDebugging) && p.removeOnFail {
+            if !(checkpoints && keepTempfileForDebugging) && p.deleteOnError() {
                 if e := os.RemoveAll(p.targetName.String()); e != nil {
                     warn(ctx, "remove: %v", e)
                 }
@@ -27988,6 +29651,38 @@ func (ctx *exec_ctx) exec(cmd, opt string) {
     ctx.start = time_pkg.Now()
 
     var noExec = truly(ctx, exec_noop{})
+    var scanStdout = ctx.scanStdout
+    var dryRun = _universe(exe).dryRun && !truly(ctx, is_configure{})
+    if dryRun { ctx.dryRunHeader(exe, cmd, env[sep:]) }
+
+    var helper string
+    var sandbox []string
+    var built bool // all recipe lines succeeded, see sandboxDone
+    if u := _universe(exe); !u.sandbox || noExec || truly(ctx, is_configure{}) {
+        // not sandboxed (configure probes the host)
+    } else if runtime.GOOS != "linux" {
+        erro(ctx, "-sandbox: unsupported on %s", runtime.GOOS, unwind{})
+    } else if s, err := exec.LookPath(u.sandboxHelper); err != nil {
+        erro(ctx, "-sandbox: %v", err, unwind{})
+    } else {
+        var scratch, target string
+        helper, ctx.sandboxed = s, true
+        sandbox, scratch, target = ctx.sandboxArgs(exe, cmd)
+        defer func() { ctx.sandboxDone(scratch, target, built) } ()
+    }
+
+    var tracer string
+    if u := _universe(exe); !(u.traceInputs || u.traceRecord) || noExec || truly(ctx, is_configure{}) {
+        // not traced
+    } else if ctx.sandboxed {
+        // undeclared reads are already reported by -sandbox
+    } else if runtime.GOOS != "linux" {
+        erro(ctx, "-trace-inputs: unsupported on %s", runtime.GOOS, unwind{})
+    } else if s, err := exec.LookPath(u.traceHelper); err != nil {
+        erro(ctx, "-trace-inputs: %v", err, unwind{})
+    } else {
+        tracer = s
+    }
     for i, src := range srcs {
         if src.trim("@"); src.s == "" { continue }
         if ctx.promptSrc && !ctx.prompt {
@@ -27998,17 +29693,28 @@ func (ctx *exec_ctx) exec(cmd, opt string) {
         }
 
         if cmd == "docker" && len(envs) > 0 { src.s = envs+" && "+src.s }
+        if dryRun { fmt.Fprintf(stdout, "%s\n", src.s) }
         if noExec { continue }
 
         ctx.known = nil
         for rx, m := range knownerrors {
             if rx.MatchString(src.s) { ctx.known = m }
         }
-        if ctx.known == nil {
+        ctx.matchers = nil
+        if u := _universe(ctx); u != nil { ctx.matchers = u.matchers.match(src.s) }
+        ctx.scanStdout = scanStdout
+        for _, m := range ctx.matchers {
+            if m.stdout { ctx.scanStdout = true }
+        }
+        if ctx.known == nil && ctx.matchers == nil {
             info(ctx, "unknown command: %s", src)
         }
 
-        ctx.sh = exec.Command(cmd, ctx.args...)
+        if c := _universe(exe).runctx; c != nil {
+            ctx.sh = exec.CommandContext(c, cmd, ctx.args...)
+        } else {
+            ctx.sh = exec.Command(cmd, ctx.args...)
+        }
         ctx.sh.Env = env
         ctx.sh.Dir = exe.workdir.String()
         ctx.sh.Stdout = &ctx.stdout
@@ -28019,11 +29725,28 @@ func (ctx *exec_ctx) exec(cmd, opt string) {
         }
         if   opt != "" { ctx.sh.Args = append(ctx.sh.Args, opt) }
         if src.s != "" { ctx.sh.Args = append(ctx.sh.Args, src.s) }
+        if ctx.sandboxed { ctx.wrap(helper, sandbox) }
+
+        var trace string
+        if tracer == "" {
+            // not traced
+        } else if f, err := os.CreateTemp("", "smart-trace-"); err != nil {
+            erro(ctx, "-trace-inputs: %v", err, unwind{})
+        } else {
+            trace = f.Name()
+            f.Close()
+            ctx.wrap(tracer, traceArgs(trace))
+        }
 
         var e = ctx.run(exe)
+        if trace != "" {
+            var inputs = traceInputs(trace, exe.workdir.String())
+            if os.Remove(trace); e == nil && ctx.status == 0 { ctx.traceUndeclared(exe, inputs) }
+        }
         if checkpoints { ctx.check_exec(i, src, e) }
-        if e != nil || ctx.status != 0 { break }
+        if e != nil || ctx.status != 0 { return }
     }
+    built = true
 }
 
 type dialect_exec struct {
@@ -28171,6 +29894,7 @@ func (p *dialect_exec) evaluate(ctx Context, args ...Value) (result Value) {
 	}
 
 	// --- 7. Execution ---
+	ec.dialect = interpName(p)
 	ec.exec(cmd, p.opt)
 
 	// --- 8. Result Packaging ---
@@ -28370,6 +30094,7 @@ func classify_pattern(ctx Context, v any) int {
 	case *strval: return classify_pattern(ctx, t.v)
 	case *strcomp: return classify_pattern(ctx, t.elems)
 	case *compound: return classify_pattern(ctx, t.elems)
+	case *qualword: return classify_pattern(ctx, t.elems)
 	case *list: return classify_pattern(ctx, t.elems)
 	case *group: return classify_pattern(ctx, t.elems)
 	case *pair: return classify_pattern(ctx, t.key) | classify_pattern(ctx, t.val)
@@ -28512,17 +30237,17 @@ func (x *execution) register_dependency(dep Value) {
 		x.ordered = append(x.ordered, dep)
 		x.set(x, defVoid, symBar, _list(x.ordered...))
 	} else {
-		x.Lock()
+		x.Lock() // also by the -parallel workers (see schedule)
 		// If traverse successfully resolved it to a file, count it towards rule metrics
 		if _, isFile := to_file(dep); isFile {
 			x.countFiles++
 		}
-		x.Unlock()
 
 		x.targets = append(x.targets, dep)
 		x.set(x, defVoid, symCaret, _list(x.targets...))
 		x.set(x, defVoid, symLangle, x.targets[0])
 		x.set(x, defVoid, symRangle, x.targets[len(x.targets)-1])
+		x.Unlock()
 	}
 
 	// =====================================================================
@@ -28645,6 +30370,9 @@ func traverse(ctx Context, val Value) {
 			if activeProj == nil { activeProj = p.owner() }
 			x.workdir = x.resolveWorkdir(ctx, activeProj)
 			x.session = newTraverseSession()
+			if tc, _ := do(ctx, is_test_case{}).(*testcase); tc != nil && tc.workdir != symEmpty {
+				x.workdir = tc.workdir // isolated by the test runner
+			}
 		}
 
 		if false && checkpoints { debug(ctx,
@@ -28668,6 +30396,7 @@ func traverse(ctx Context, val Value) {
 					defer func() {
 						switch e := recover().(type) {
 						case traverse_state: state = e.uint
+						case test_skipped: panic(e) // reported by the test runner
 						default:
 							if e != nil {
 								erro(x, "%v", e, callstack{num: 20}, trace_ctx{5}, trace_val{5, p.target})
@@ -28693,6 +30422,15 @@ func traverse(ctx Context, val Value) {
 			erro(ctx, "no execution context: %v", p, callstack{num:10})
 			return
 		}
+		if _universe(x).clean {
+			// -clean only walks the rules and their (precious) marks
+			for _, m := range p.list {
+				if __symbol(ctx, m.elems[0]) == symPrecious && x.interp(pc(ctx, m.pos), symPrecious, m.elems[1:]) {
+					modify(ctx, &m.group, true)
+				}
+			}
+			return
+		}
 
 		x.Wait()
 
@@ -29707,26 +31445,62 @@ func _rw1(pos Pos, s string) Value {
 
 func makeDate(pos Pos, s time_pkg.Time) *date  { return &date{datetime{valbase{pos},s}} }
 func makeTime(pos Pos, t time_pkg.Time) *time  { return &time{datetime{valbase{pos},t}} }
-func makeUrl(pos Pos, s *neturl.URL) *url {
-	if s.RawQuery != "" { panic("TODO: url query: "+s.RawQuery) }
+func makeUrl(pos Pos, lit string, s *neturl.URL) *url {
+    // at returns the position of the component str within the literal,
+    // searching forward from the offset of the previous component.
+    var off int
+    var at = func(str string) Pos {
+        if str != "" {
+            if i := strings.Index(lit[off:], str); i >= 0 {
+                off += i
+                return pos + Pos(off)
+            }
+        }
+        return pos + Pos(off)
+    }
 
-    var host, port string
-    var v = strings.Split(s.Host, ":")
-    if len(v) == 1 { host = v[0] }
-    if len(v) == 2 { host, port = v[0], v[1] }
+    var host, port = s.Hostname(), s.Port()
 
-    var password Value
-    if pw, ok := s.User.Password(); ok { password = _raw(pos, pw) }
-    return &url{ // FIXME: calculate component positions
-        Scheme:   _word(pos, intern(s.Scheme)),
-        Username: _raw(pos, s.User.Username()),
-        Password: password,
-        Host:     _word(pos, intern(host)),
-        Port:     _word(pos, intern(port)),
-        Path:     _word(pos, intern(s.Path)),
-        // Query:    _word(pos, intern(s.RawQuery)),
-        Fragment: _word(pos, intern(s.Fragment)),
+    // components are positioned in order (see at)
+    var u = &url{ Scheme: _word(at(s.Scheme), intern(s.Scheme)) }
+    if s.User != nil {
+        u.Username = _raw(at(s.User.Username()), s.User.Username())
+        if pw, ok := s.User.Password(); ok { u.Password = _raw(at(pw), pw) }
+    }
+    u.Host = _word(at(host), intern(host))
+    if port != "" {
+        u.Port = _word(at(port), intern(port))
+    }
+    u.Path = _word(at(s.Path), intern(s.Path))
+    if s.RawQuery != "" {
+        u.Query = parseUrlQuery(at(s.RawQuery), s.RawQuery)
+    }
+    if s.Fragment != "" {
+        u.Fragment = _word(at(s.Fragment), intern(s.Fragment))
+    }
+    return u
+}
+
+// parseUrlQuery splits a raw query string into an ordered list of values,
+// `key=value` components become pairs and the others are kept as words.
+func parseUrlQuery(pos Pos, raw string) (query []Value) {
+    var off int
+    for _, comp := range strings.Split(raw, "&") {
+        var p = pos + Pos(off)
+        off += len(comp) + 1
+        if comp == "" { continue }
+
+        var key, val, hasVal = strings.Cut(comp, "=")
+        if k, e := neturl.QueryUnescape(key); e == nil { key = k }
+        if !hasVal {
+            query = append(query, _word(p, intern(key)))
+            continue
+        }
+        var vp = p + Pos(len(comp)-len(val))
+        if v, e := neturl.QueryUnescape(val); e == nil { val = v }
+        query = append(query, makePair(_word(p, intern(key)), _raw(vp, val)))
     }
+    return
 }
 
 func list_t[T Value](ii ...T) *list {
@@ -29851,7 +31625,7 @@ func ParseTime(pos Pos, s string) *time {
 
 func ParseURL(pos Pos, s string) *url {
 	if u, e := neturl.Parse(s); e == nil {
-		return makeUrl(pos,u)
+		return makeUrl(pos,s,u)
 	} else {
 		panic(e)
 	}
@@ -31416,6 +33190,7 @@ type project struct { // A project is a Logical DAG.
 
 	patterns []*rule // order is important
 	configs  []*def  // configure entries
+	probes   map[Symbol]*configprobe // how configs are produced (see -config-show)
 	main     *rule
 
 	ext project_ext
@@ -31782,6 +33557,7 @@ func (p *project) removeTempSubdirs(ctx Context, cleanDirs ...string) {
 		if clean || uni.cleanDotCache { cleanDirs = append(cleanDirs, ".cache") }
 		if clean || uni.cleanDotDeps  { cleanDirs = append(cleanDirs, ".deps") }
 		if clean || uni.cleanDotGrep  { cleanDirs = append(cleanDirs, ".grep") }
+		if clean { cleanDirs = append(cleanDirs, ".inputs") }
 	}
 
 	// 1. FAST PATH: Fetch the base temp directory directly!
@@ -32872,11 +34648,53 @@ func (p *execution) dirty(ctx Context, aa ...Value) (outdated bool) {
 func (p *execution) prerequisites(va []Value, ordered bool) {
     defer p.Wait()
     p._ordered = ordered
+    if !ordered && len(va) > 1 && _universe(p).parallel {
+        p.schedule(va)
+        return
+    }
     for _, p.prerequisite = range va { traverse(p, p.prerequisite) }
     p.prerequisite = nil
     return
 }
 
+// schedule traverses the prerequisites in workers (-parallel), each one
+// holding a jobserver slot while it works. The slot of the worker running
+// this execution (if any) is given back while waiting for them.
+func (p *execution) schedule(va []Value) {
+    if s, _ := do(p, held_job{}).(*jobslot); s != nil {
+        s.release()
+        defer func() { s.release = acquireJob(p) }()
+    }
+
+    var n = jobWorkers(p)
+    if n > len(va) { n = len(va) }
+
+    var next = make(chan Value)
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    var failed struct { sync.Once; e any } // the first panic, raised again here
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for v := range next {
+                func() {
+                    var s = &jobslot{acquireJob(p)}
+                    defer func() { s.release() }()
+                    defer func() {
+                        if e := recover(); e != nil { failed.Do(func() { failed.e = e }) }
+                    }()
+                    traverse(&job_ctx{p, s, &mu}, v)
+                }()
+            }
+        }()
+    }
+    for _, v := range va { next <- v }
+    close(next)
+    wg.Wait()
+    if failed.e != nil { panic(failed.e) }
+}
+
 func _program(ctx Context) (p *program) {
     p, _ = do(ctx, get_program{}).(*program)
     return
@@ -32893,6 +34711,16 @@ type program struct {
 	// isConfigure bool // OPTIMIZATION: Statically tracks configure-time probe rules
 }
 
+// modified tells if the program has modifiers, e.g. (download) or (writefile).
+func (prog *program) modified() bool {
+    for _, l := range [][]Value{prog.depends, prog.ordered} {
+        for _, v := range l {
+            if _, ok := unloc(v).(*modification); ok { return true }
+        }
+    }
+    return false
+}
+
 func (prog *program) check_exe(ctx *execution) {
 	// 1. Extract the current frame's authentic target name directly from our unified scope
 	targetObj := ctx.lookup(symAt)
@@ -33016,10 +34844,314 @@ func (prog *program) execute(exe *execution) (res Value) {
 	exe.prerequisites(prog.depends, false)
 	exe.prerequisites(prog.ordered, true)
 
+	if _universe(exe).clean {
+		if len(prog.recipes) > 0 || prog.modified() { exe.cleanTarget() }
+		return
+	}
 	if len(prog.recipes) == 0 { return }
+	exe.tracedInputs()
+	exe.chained()
 	return prog.result_or_default_interpret(exe)
 }
 
+type targetmark uint8
+
+const (
+	markPrecious targetmark = 1 << iota
+	markIntermediate
+	markSecondary
+	markExisted // before the build, never removed as an intermediate
+)
+
+func markTarget(ctx Context, f *file, m targetmark) {
+	var name = f.fullname()
+	if m&markPrecious == 0 {
+		if p := _project(ctx); p != nil && p.precious(ctx, f) { m |= markPrecious }
+	}
+	var marks = &_universe(ctx).runs.marks
+	marks.Lock()
+	defer marks.Unlock()
+	if marks.m == nil { marks.m = make(map[Symbol]targetmark) }
+	if _, marked := marks.m[name]; !marked {
+		if f.exists() { m |= markExisted }
+		marks.files = append(marks.files, f)
+	}
+	marks.m[name] |= m
+}
+
+func markTargets(exe *execution, args []Value, m targetmark) {
+	if len(args) == 0 {
+		if val := auto_get(exe, symAt); val != nil { args = append(args, val) }
+	}
+	for _, arg := range merge(args...) {
+		if f := as_file(exe, arg, exe.traverseProjs()...); f != nil {
+			markTarget(exe, f, m)
+		} else {
+			erro(exe, "'%v' is not a file", arg)
+		}
+	}
+}
+
+func targetMarked(ctx Context, v Value, m targetmark) bool {
+	f, ok := to_file(v)
+	if !ok || f == nil { return false }
+	var marks = &_universe(ctx).runs.marks
+	marks.Lock()
+	defer marks.Unlock()
+	return marks.m[f.fullname()]&m != 0
+}
+
+// chained marks the target of a pattern rule as an intermediate if it's
+// a prerequisite of another pattern rule (i.e. chained stemmed rules), it's
+// only done with -auto-intermediate, otherwise rules mark (intermediate).
+func (p *execution) chained() {
+	if !_universe(p).autoIntermediate || _stems(p) == nil { return }
+	if c := p.caller(); c == nil || _stems(c) == nil { return }
+	if val := auto_get(p, symAt); val == nil {
+		// no target
+	} else if f := as_file(p, val, p.traverseProjs()...); f != nil {
+		markTarget(p, f, markIntermediate)
+	}
+}
+
+// removeIntermediates removes the intermediates made by the build, except
+// the (precious) and (secondary) ones.
+func (u *universe) removeIntermediates(ctx Context) {
+	if u.noExec || u.dryRun || u.clean { return } // -clean keeps the marks for cleanOutputs
+	var marks = &u.runs.marks
+	marks.Lock()
+	defer marks.Unlock()
+	for _, f := range marks.files {
+		var m = marks.m[f.fullname()]
+		if m&markIntermediate == 0 || m&(markPrecious|markSecondary|markExisted) != 0 {
+			continue
+		}
+		var name = f.fullname().String()
+		if fi, err := os.Lstat(name); err != nil || fi.IsDir() {
+			// not made
+		} else if err = os.Remove(name); err != nil {
+			erro(ctx, "%v", err)
+		} else {
+			f.stat(ctx, true)
+			prompt(ctx, "removed intermediate %v\n", name)
+		}
+	}
+}
+
+// runstate is the state of a run of the goals (see universe.run), each run
+// starts with a new one.
+type runstate struct {
+	marks struct { // the (precious), (intermediate) and (secondary) targets
+		sync.Mutex
+		m map[Symbol]targetmark // by fullname
+		files []*file // in marking order
+	}
+	cleaning struct { // the outputs of the rules walked by -clean
+		sync.Mutex
+		files []*file
+		projs map[*file]*project
+	}
+}
+
+// targetFile returns the target of the rule as a file, or nil.
+func (p *execution) targetFile() *file {
+	var target = auto_target_value(p)
+	if isTrivial(target) { return nil }
+	if f := as_file(p, target, p.traverseProjs()...); f != nil && !f.isSysFile() { return f }
+	return nil
+}
+
+// cleanTarget records the target of the rule (which has recipes or
+// modifiers) and the files stamped for it to be removed by -clean.
+func (p *execution) cleanTarget() {
+	var f = p.targetFile()
+	if f == nil { return }
+
+	var proj = _project(p)
+	if proj == nil { return }
+
+	var files = []*file{ f }
+	for _, s := range stampedFiles(p, f) {
+		if sf := _stat(p, intern(s), stat_nonexist{true}); sf != nil { files = append(files, sf) }
+	}
+
+	var cleaning = &_universe(p).runs.cleaning
+	cleaning.Lock()
+	defer cleaning.Unlock()
+	if cleaning.projs == nil { cleaning.projs = make(map[*file]*project) }
+	for _, f := range files {
+		if _, seen := cleaning.projs[f]; !seen {
+			cleaning.projs[f] = proj
+			cleaning.files = append(cleaning.files, f)
+		}
+	}
+}
+
+// stamps is the files registered by stamp_target (e.g. the ones written by
+// (extract)) for the targets of the rules, saved in the temp dir of the
+// workdir by the universe's teardown so that -clean finds them.
+type stamps struct {
+	sync.Mutex
+	loaded, dirty bool
+	m map[string][]string // target → files
+}
+
+func stampedPath(ctx Context) string {
+	return joinTmpPath(ctx, _universe(ctx).workdir, intern("stamps")).String()
+}
+
+// load reads the "target\tfile" lines, stamped must be locked.
+func (stamped *stamps) load(ctx Context) {
+	if stamped.loaded { return } else {
+		stamped.loaded, stamped.m = true, make(map[string][]string)
+	}
+	data, err := os.ReadFile(stampedPath(ctx))
+	if err != nil { return }
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, s, ok := strings.Cut(line, "\t"); ok {
+			stamped.m[k] = append(stamped.m[k], s)
+		}
+	}
+}
+
+// stampFile records the file stamped by the rule of x for its target.
+func stampFile(x *execution, f *file) {
+	var t = x.targetFile()
+	if t == nil || t == f { return }
+
+	var k, s = t.fullname().String(), f.fullname().String()
+	var stamped = &_universe(x).stamped
+	stamped.Lock(); defer stamped.Unlock()
+	stamped.load(x)
+	for _, v := range stamped.m[k] {
+		if v == s { return }
+	}
+	stamped.m[k] = append(stamped.m[k], s)
+	stamped.dirty = true
+}
+
+// stampedFiles returns the files stamped for the target f.
+func stampedFiles(ctx Context, f *file) []string {
+	var stamped = &_universe(ctx).stamped
+	stamped.Lock(); defer stamped.Unlock()
+	stamped.load(ctx)
+	return stamped.m[f.fullname().String()]
+}
+
+// dropStamped forgets the files stamped for the target removed by -clean.
+func dropStamped(ctx Context, name string) {
+	var stamped = &_universe(ctx).stamped
+	stamped.Lock(); defer stamped.Unlock()
+	if _, y := stamped.m[name]; y {
+		delete(stamped.m, name)
+		stamped.dirty = true
+	}
+}
+
+// save writes the stamps file if they changed.
+func (stamped *stamps) save(ctx Context) {
+	stamped.Lock(); defer stamped.Unlock()
+	if !stamped.dirty { return }
+
+	var keys []string
+	for k := range stamped.m { keys = append(keys, k) }
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		for _, s := range stamped.m[k] { fmt.Fprintf(&b, "%s\t%s\n", k, s) }
+	}
+	var s = stampedPath(ctx)
+	if err := os.MkdirAll(filepath.Dir(s), os.FileMode(0755)); err != nil {
+		erro(ctx, "stamps: %v", err)
+	} else if err = os.WriteFile(s+".tmp", b.Bytes(), 0666); err != nil {
+		erro(ctx, "stamps: %v", err)
+	} else if err = os.Rename(s+".tmp", s); err != nil {
+		erro(ctx, "stamps: %v", err)
+	} else {
+		stamped.dirty = false
+	}
+}
+
+// precious tells if the file is marked (precious) or matches the project's
+// .precious patterns, it's then kept by -clean, -delete-on-error and the
+// removal of intermediates.
+func (p *project) precious(ctx Context, f *file) bool {
+	if targetMarked(ctx, f, markPrecious) { return true }
+	var d = p.resolveDef(ctx, intern(".precious"))
+	if d == nil || d.value == nil { return false }
+
+	var ctx2 = closure_with(ctx, p)
+	var name = f.fullname().String()
+	var rel, _ = filepath.Rel(p.absPath.String(), name)
+	for _, pat := range merge(eval(ctx2, d.value)) {
+		for _, s := range []string{name, rel, filepath.Base(name)} {
+			if s == "" { continue }
+			if matched, _, _, _ := match(ctx2, pat, _pathStr(ctx2, s)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cleanGoals walks the rules reachable from the goals (only applying the
+// (precious) modifiers, without running the recipes) and removes the targets
+// they produce, except the precious ones, and also the temp dirs of their
+// projects for -distclean. With -dry, it only lists them.
+func (u *universe) cleanGoals(ctx Context) (failed int) {
+	if u.run(ctx); u.flush(u) > 0 { return 1 }
+	return u.cleanOutputs(ctx)
+}
+
+// cleanOutputs removes (or lists) the outputs recorded by cleanTarget.
+func (u *universe) cleanOutputs(ctx Context) (failed int) {
+	var cleaning = &u.runs.cleaning
+	cleaning.Lock()
+	defer cleaning.Unlock()
+
+	var tmpdirs []string
+	for _, f := range cleaning.files {
+		var proj = cleaning.projs[f]
+		var name = f.fullname().String()
+		if u.distclean {
+			if _, s := proj.tempdir(ctx); s != "" && s != "/" && s != proj.absPath.String() {
+				tmpdirs = append(tmpdirs, s)
+			}
+		}
+		if !u.dryRun && !proj.precious(ctx, f) { dropStamped(ctx, name) }
+		if fi, err := os.Lstat(name); err != nil || fi.IsDir() {
+			continue // not produced (or a phony target)
+		} else if proj.precious(ctx, f) {
+			if u.verbose { prompt(ctx, "%s: precious %v\n", proj.name, name) }
+		} else if u.dryRun {
+			fmt.Fprintf(stdout, "%s\n", name)
+		} else if err = os.Remove(name); err != nil {
+			erro(ctx, "%v", err)
+			failed++
+		} else {
+			f.stat(ctx, true)
+			prompt(ctx, "%s: removed %v\n", proj.name, name)
+		}
+	}
+
+	sort.Strings(tmpdirs)
+	for i, s := range tmpdirs {
+		if i > 0 && s == tmpdirs[i-1] { continue }
+		if _, err := os.Stat(s); err != nil {
+			// nothing to remove
+		} else if u.dryRun {
+			fmt.Fprintf(stdout, "%s/\n", s)
+		} else if err = os.RemoveAll(s); err != nil {
+			erro(ctx, "%v", err)
+			failed++
+		} else {
+			prompt(ctx, "removed %v\n", s)
+		}
+	}
+	return
+}
+
 func scanExitStatts(err error) (n, status int) {
     switch e := err.(type) {
     case *exitstatus: n, status = 1, e.int
@@ -33281,14 +35413,28 @@ func (ctx *modifier_configurefile) x(args ...Value) (result any) {
 
 // extract-configuration extracts configuration from C/C++ files, example usage:
 //
-//      config.h.in:[(extract-configuration)]: $(wildcard *.cpp)
+//      config.h.in: $(wildcard *.cpp *.h) {(extract-configuration)}
 //
+// Every HAVE_*/ENABLE_* referenced by preprocessor conditionals (or matched by
+// -rx=...) is emitted as a sorted `#undef` template, commented with the places
+// using it, suitable for (configure-file). The target (or -target=FILE,
+// relative to the project) is only rewritten when its content changes.
 type modifier_extractconfiguration struct { modifier_
     mode os.FileMode "mode"
     makePath bool "path"
     target string "target"
     rxs []*regexp.Regexp "rx,regex" // regexp.Compile(s)
 }
+
+var (
+    rxExtractConfigurationLine = regexp.MustCompile(`^[\t ]*#[\t ]*(?:if|ifdef|ifndef|elif|elifdef|elifndef)\b`)
+    rxExtractConfigurationName = regexp.MustCompile(`\b((?:HAVE|ENABLE)_[A-Za-z0-9_]+)\b`)
+    extractConfigurationExts   = map[string]bool{
+        ".c": true, ".cc": true, ".cpp": true, ".cxx": true, ".c++": true, ".m": true, ".mm": true,
+        ".h": true, ".hh": true, ".hpp": true, ".hxx": true, ".h++": true, ".inl": true,
+    }
+)
+
 func (ctx *modifier_extractconfiguration) x(exe *execution, args ...Value) (result any) {
 	var pats []Value
 	var pos = _position(ctx)
@@ -33299,71 +35445,56 @@ func (ctx *modifier_extractconfiguration) x(exe *execution, args ...Value) (resu
 		}
 	}
 
-	if len(pats) == 0 {
-		erro(ctx, "extract-configuration: missing file names (patterns)")
-		return
-	}
-
-	if len(ctx.rxs) == 0 {
-		erro(ctx, "extract-configuration: missing -rx=... flags")
-		return
-	}
-
-	if ctx.target == "" { ctx.target = "configuration" }
-
 	// --- 1. Symbol Extraction for Output File ---
+	var outFile *file
 	var outFileSym Symbol
 	var outFileStr string
 
-	if target := auto_get(ctx, symAt); isNull(target) {
+	if ctx.target != "" {
+		var s = ctx.target
+		if p := _project(ctx); !filepath.IsAbs(s) && p != nil {
+			s = filepath.Join(p.absPath.String(), s)
+		}
+		outFileSym = intern(s)
+		outFile = _stat(ctx, outFileSym, stat_nonexist{true})
+		outFileStr = s
+	} else if target := auto_get(ctx, symAt); isNull(target) {
 		erro(ctx, " target '@' is undefined")
 		return
 	} else {
-		outFileSym, _ = fullname_sym(ctx, target)
-		if outFileSym == symEmpty {
+		outFile, outFileSym = file_fullname(ctx, target, closure_projects(ctx)...)
+		if outFile == nil || outFileSym == symEmpty {
 			erro(ctx, " target '@' has empty/invalid fullname")
 			return
 		}
 		// Extract string exactly once for the physical OS boundary
 		outFileStr = outFileSym.String()
+		if !outFile.exists() { outFile.stat(ctx, true) }
 	}
 
-	// --- 2. Zero-Allocation Path Generation ---
-	if ctx.makePath {
-		dirSym := __symDir(outFileSym)
-		if dirSym != symEmpty && dirSym != symDot && dirSym != symPathSep {
-			if err := os.MkdirAll(dirSym.String(), os.FileMode(0755)); err != nil {
-				erro(ctx, " make path failed: %v", err)
-				return
-			}
-		}
-	}
-
-	var fil, err = os.OpenFile(outFileStr, os.O_RDWR|os.O_CREATE|os.O_TRUNC, ctx.mode)
-	if err != nil {
-		erro(ctx, " open file failed: %v", err)
-		return
+	// --- 2. Source Collection (patterns or known C/C++ extensions) ---
+	var sources []Value
+	var accept = func(s string) bool {
+		return extractConfigurationExts[strings.ToLower(filepath.Ext(s))]
 	}
-
-	var out = bufio.NewWriter(fil)
-
-	// --- 3. VFS Cache Piercing (Critical Fix) ---
-	// We MUST flush, close, AND stamp the file inside the defer to ensure
-	// the VFS reads the final physical size and modified time!
-	defer func() {
-		out.Flush()
-		fil.Close()
-
-		if target := auto_get(ctx, symAt); !isNull(target) {
-			if fFile := as_file(ctx, target); fFile != nil {
-				stamp_target(exe, fFile)
-			} else if fFile := _stat(ctx, outFileSym); fFile != nil {
-				stamp_target(exe, fFile)
-			}
+	var walk = func(s Symbol) error {
+		if len(pats) > 0 {
+			return walkFiles(ctx, s, pats, func(f *file, err error) error {
+				if err == nil { sources = append(sources, f) }
+				return err
+			})
 		}
-	}()
+		return filepath.Walk(s.String(), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && accept(path) {
+				sources = append(sources, _stat(ctx, intern(path), stat_fileinfo{info}))
+			}
+			return err
+		})
+	}
 
-	var depends, sources []Value
+	var err error
+	var newest int64
+	var depends []Value
 	if d := auto_get(ctx, symCaret); !isTrivial(d) { depends = xmerge(ctx, d) }
 
 	var patsVal = ease(ctx, pats)
@@ -33371,16 +35502,15 @@ func (ctx *modifier_extractconfiguration) x(exe *execution, args ...Value) (resu
 		var a []Value
 		switch d := depend.(type) {
 		case *file:
-			if a = merge(call(ctx, symFilter, nil, patsVal, d)); a != nil {
+			if len(pats) == 0 {
+				if accept(d.name.String()) { sources = append(sources, d) }
+			} else if a = merge(call(ctx, symFilter, nil, patsVal, d)); a != nil {
 				sources = append(sources, a...)
 			}
 		case *path:
-			err = walkFiles(ctx, __symbol(ctx, d), pats, func(file *file, err error) error {
-				if err == nil { sources = append(sources, file) }
-				return err
-			})
+			err = walk(__symbol(ctx, d))
 		default:
-			// --- 4. Pure Symbol Stat Resolution ---
+			// --- 3. Pure Symbol Stat Resolution ---
 			var s = __symbol(ctx, d)
 
 			// We pass the full Walled Garden Symbol 's' natively into _stat!
@@ -33390,44 +35520,119 @@ func (ctx *modifier_extractconfiguration) x(exe *execution, args ...Value) (resu
 			if !f.exists() {
 				erro(ctx, " extract-configuration: `%s` file not found", s.String())
 				return
-			} else if f.isDir() { // Ultra-fast boolean check
-				err = walkFiles(ctx, s, pats, func(f *file, err error) error {
-					if err == nil { sources = append(sources, f) }
-					return err
-				})
-			} else if a = merge(call(ctx, symFilter, nil, patsVal, d)); a != nil {
-				sources = append(sources, a...)
+			} else if !f.isDir() {
+				if len(pats) == 0 {
+					if accept(s.String()) { sources = append(sources, f) }
+				} else if a = merge(call(ctx, symFilter, nil, patsVal, d)); a != nil {
+					sources = append(sources, a...)
+				}
+			} else {
+				err = walk(f.fullname())
 			}
 		}
+		if err != nil {
+			erro(ctx, " extract-configuration: %v", err)
+			return
+		}
 	}
 
-	var u = _universe(ctx)
-	var exprs = make(map[string]struct{})
-
-sourceloop:
+	// --- 4. Scan Sources into the `#undef` template ---
+	var filenames []Symbol
 	for _, source := range sources {
-		var filename Symbol
 		switch t := source.(type) {
 		case *file:
 			// Fast extraction from the cached Symbol!
-			filename = t.fullname()
+			filenames = append(filenames, t.fullname())
+			if t._mtime > newest { newest = t._mtime }
 		default:
-			filename = __symbol(ctx, t)
+			filenames = append(filenames, __symbol(ctx, t))
 		}
+	}
+
+	var data bytes.Buffer
+	var num = extractconfiguration(ctx, pos, _project(ctx).absPath.String(), ctx.rxs, filenames, &data)
 
+	if data.Len() == 0 {
+		warn(ctx, "%v: no configuration names in %d sources", trimPrompt(outFileStr), len(sources), warncat("configure"))
+	}
+
+	if dryModifier(ctx, "extract-configuration", "%s (%d names)", trimPrompt(outFileStr), num) {
+		return outFile
+	}
+
+	// --- 5. Rewrite only on changes ---
+	if outFile.exists() {
+		var same bool
+		if same, err = crc64CheckFileModeContent(ctx, outFileStr, data.Bytes(), ctx.mode); err != nil {
+			erro(ctx, "crc64 checksum failed: %v", err)
+			return
+		} else if same {
+			if newest > outFile._mtime { err = touch(ctx, outFile, 0, false, time_pkg.Unix(0, newest)) }
+			return outFile
+		}
+	} else if ctx.makePath {
+		dirSym := __symDir(outFileSym)
+		if dirSym != symEmpty && dirSym != symDot && dirSym != symPathSep {
+			if err = os.MkdirAll(dirSym.String(), os.FileMode(0755)); err != nil {
+				erro(ctx, " make path failed: %v", err)
+				return
+			}
+		}
+	}
+
+	if err = os.WriteFile(outFileStr, data.Bytes(), ctx.mode); err != nil {
+		erro(ctx, " write file failed: %v", err)
+		return
+	}
+
+	if ctx.verbose {
+		prompt(ctx, "update %v …… %d names (%d sources)\n", trimPrompt(outFileStr), num, len(sources))
+	}
+
+	// --- 6. VFS Cache Piercing ---
+	if ctx.target != "" {
+		return stamp_target(exe, _stat(ctx, outFileSym))
+	} else if f := stamp_target(exe, auto_get(ctx, symAt)); f != nil {
+		return f
+	} else if f := _stat(ctx, outFileSym); f != nil {
+		return stamp_target(exe, f)
+	}
+	return
+}
+
+// extractconfiguration scans filenames for configuration names (HAVE_*/ENABLE_*
+// in preprocessor conditionals, or the first submatch of rxs) and writes the
+// sorted `#undef` template to out, returning the number of names.
+func extractconfiguration(ctx Context, pos Position, dir string, rxs []*regexp.Regexp, filenames []Symbol, out *bytes.Buffer) int {
+	var u = _universe(ctx)
+	var usages = make(map[string][]string)
+
+	for _, filename := range filenames {
 		sc, err := u.fset.openScanFile(filename)
 		if err != nil {
-			prompt(ctx, "%v: (configure) %v: %v\n", pos, source, err)
-			continue sourceloop
+			prompt(ctx, "%v: (configure) %v: %v\n", pos, filename, err)
+			continue
 		}
 
-	scanloop:
-		for sc.Scan() {
-			var s = sc.Text()
-			for _, x := range ctx.rxs {
-				if sm := x.FindStringSubmatch(s); sm != nil {
-					exprs[sm[1]] = struct{}{}
-					break scanloop
+		var name = filename.String()
+		if s, e := filepath.Rel(dir, name); e == nil && !strings.HasPrefix(s, "..") { name = s }
+
+		var seen = make(map[string]bool)
+		for line := 1; sc.Scan(); line += 1 {
+			var s, found = sc.Text(), [][]string(nil)
+			if len(rxs) > 0 {
+				for _, x := range rxs {
+					found = append(found, x.FindAllStringSubmatch(s, -1)...)
+				}
+			} else if rxExtractConfigurationLine.MatchString(s) {
+				found = rxExtractConfigurationName.FindAllStringSubmatch(s, -1)
+			}
+			for _, sm := range found {
+				if len(sm) < 2 || sm[1] == "" { continue }
+				var at = fmt.Sprintf("%s:%d", name, line)
+				if k := sm[1]+"@"+at; !seen[k] {
+					seen[k] = true
+					usages[sm[1]] = append(usages[sm[1]], at)
 				}
 			}
 		}
@@ -33435,16 +35640,15 @@ sourceloop:
 	}
 
 	var keys []string
-	for x := range exprs { keys = append(keys, x) }
+	for x := range usages { keys = append(keys, x) }
 	sort.Strings(keys)
 
-	for _, k := range keys { fmt.Fprintf(out, "#%s :{(configure)}\n", k) }
-
-	fmt.Fprintf(out, "\n")
-	fmt.Fprintf(out, "%s:{(configure -check)}\\\n", ctx.target)
-	for _, k := range keys { fmt.Fprintf(out, "  %s \\\n", k) }
-	fmt.Fprintf(out, "\n")
-	return
+	for i, k := range keys {
+		if i > 0 { fmt.Fprintf(out, "\n") }
+		fmt.Fprintf(out, "/* %s: %s */\n", k, strings.Join(usages[k], ", "))
+		fmt.Fprintf(out, "#undef %s\n", k)
+	}
+	return len(keys)
 }
 
 type property uint64
@@ -33628,11 +35832,17 @@ func joinTmpPath(ctx Context, base, rel Symbol) Symbol {
 	}
 
 	// --- Final Path Generation ---
+	// Each toolchain profile keeps its own temp dirs (and configuration.sm).
+	tmp := symTmp
+	if u := _universe(ctx); u != nil && u.toolchain != "" {
+		tmp = intern("tmp-" + u.toolchain)
+	}
 	if len(relSeq) >= 2 && relSeq[0] == symTmp && relSeq[1] == symSlash {
-		return __symPathJoin(baseTmpPath, symDotSmart, rel)
+		if len(relSeq) == 2 { return __symPathJoin(baseTmpPath, symDotSmart, tmp) }
+		return __symPathJoin(baseTmpPath, symDotSmart, tmp, intern_seq(relSeq[2:]))
 	}
 
-	return __symPathJoin(baseTmpPath, symDotSmart, symTmp, rel)
+	return __symPathJoin(baseTmpPath, symDotSmart, tmp, rel)
 }
 
 func loadSearchPaths(ctx Context, s Symbol) (paths []Symbol) {
@@ -33692,39 +35902,21 @@ func Main() {
 	// Boot the universe first. It will now yield a perfectly scrubbed paths array!
 	ctx := new_universe()
 
+	var code int // exit code, the SARIF log is written before exiting
+	defer func() {
+		ctx.teardown()
+		if code != 0 { os.Exit(code) }
+	} ()
+
 	// =================================================================
 	// 1. MODULE SEARCH PATH RESOLUTION (using statcache & deduplication)
 	// =================================================================
-	var modules = filepath.FromSlash(`.smart/modules`)
-
-	// 1a. Search underneath Standard Roots & Workspace
-	for _, root := range []string{`/Volumes`, `/media`, `/`, os.Getenv("HOME")} {
-		if root == "" { continue }
-		for _, base := range []string{root, filepath.Join(root, "workspace")} {
-			sym := intern(filepath.Join(base, modules))
-			if f := _stat(ctx, sym); f != nil && f.isDir() {
-				// Prevent double-adding if new_universe already found it
-				if !ctx.paths.has(sym) { ctx.paths = append(ctx.paths, sym) }
-			}
-		}
-	}
-
-	// 1b. Search within GOPATH splits
-	if gopath := os.Getenv("GOPATH"); gopath != "" {
-		for _, root := range filepath.SplitList(gopath) {
-			if root == "" { continue }
-			for _, base := range []string{root, filepath.Join(root, "src")} {
-				sym := intern(filepath.Join(base, modules))
-				if f := _stat(ctx, sym); f != nil && f.isDir() {
-					if !ctx.paths.has(sym) { ctx.paths = append(ctx.paths, sym) }
-				}
-			}
-		}
-	}
+	searchModules(ctx)
 
 	// =================================================================
 	// 2. UNIVERSE LOADING & EXECUTION
 	// =================================================================
+	defer startJobserver(ctx)()
 	ctx.load(main_ctx{ctx})
 
 	if ctx.flush(ctx) > 0 {
@@ -33737,6 +35929,17 @@ func Main() {
 		print_configuration(ctx)
 	} else if numUpdatedPlugins > 0 { // see buildPlugin
 		prompt(ctx, "plugins updated, please relaunch.\n")
+	} else if ctx.replMode {
+		ctx.repl(main_ctx{ctx})
+	} else if ctx.testMode {
+		if ctx.test(main_ctx{ctx}) > 0 { code = 1 }
+	} else if ctx.configShow || ctx.configSet != nil || ctx.configUnset != nil {
+		if ctx.config(main_ctx{ctx}) > 0 { code = 1 }
+	} else if ctx.grepCacheStats || ctx.grepCacheDump != nil {
+		ctx.grepCacheInfo(main_ctx{ctx})
+	} else if ctx.clean || ctx.distclean {
+		ctx.clean = true
+		if ctx.cleanGoals(main_ctx{ctx}) > 0 { code = 1 }
 	} else if result := ctx.run(main_ctx{ctx}); ctx.flush(ctx) > 0 {
 		prompt(ctx, "run work got %d errors\n", ctx.erros)
 	} else if result != nil {
@@ -33755,6 +35958,272 @@ func Main() {
 	}
 }
 
+// teardown saves the grep cache, flushes the diagnostics and closes the
+// -diag-output file, also when the flush panics (too many errors).
+func (u *universe) teardown() {
+	defer u.diagnostic.ctl.format.close()
+	saveGrepCache(u)
+	u.stamped.save(u)
+	u.flush(u)
+}
+
+// searchModules adds the .smart/modules directories found in the standard
+// roots, the workspace and GOPATH to the search paths.
+func searchModules(ctx *universe) {
+	var modules = filepath.FromSlash(`.smart/modules`)
+
+	// 1a. Search underneath Standard Roots & Workspace
+	for _, root := range []string{`/Volumes`, `/media`, `/`, os.Getenv("HOME")} {
+		if root == "" { continue }
+		for _, base := range []string{root, filepath.Join(root, "workspace")} {
+			sym := intern(filepath.Join(base, modules))
+			if f := _stat(ctx, sym); f != nil && f.isDir() {
+				// Prevent double-adding if new_universe already found it
+				if !ctx.paths.has(sym) { ctx.paths = append(ctx.paths, sym) }
+			}
+		}
+	}
+
+	// 1b. Search within GOPATH splits
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		for _, root := range filepath.SplitList(gopath) {
+			if root == "" { continue }
+			for _, base := range []string{root, filepath.Join(root, "src")} {
+				sym := intern(filepath.Join(base, modules))
+				if f := _stat(ctx, sym); f != nil && f.isDir() {
+					if !ctx.paths.has(sym) { ctx.paths = append(ctx.paths, sym) }
+				}
+			}
+		}
+	}
+}
+
+// Hooks intercept diagnostics of an embedded Universe. Assert returns true
+// if it handled the assertion, otherwise the failure is reported as usual.
+type Hooks struct {
+	Assert func(pos Position, expr string, ok bool) bool
+	Debug  func(pos Position, msg string)
+	Error  func(pos Position, msg string)
+}
+
+func (h Hooks) hooks() (r hooks) {
+	if f := h.Assert; f != nil {
+		r.assert = func(c Context, v Value, y bool) bool {
+			var s string
+			if v != nil { s = v.String() }
+			return f(_position(c), s, y)
+		}
+	}
+	if f := h.Debug; f != nil {
+		r.debug = func(c Context, s string, _ []Value) { f(_position(c), s) }
+	}
+	if f := h.Error; f != nil {
+		r.error = func(c Context, s string, _ []Value) { f(_position(c), s) }
+	}
+	return
+}
+
+// An Option configures a Universe created by New.
+type Option func(*Universe)
+
+// WithWorkdir sets the directory of the main project, it defaults to the
+// current working directory.
+func WithWorkdir(dir string) Option { return func(x *Universe) { x.workdir = dir } }
+
+// WithArgs sets the command line arguments (flags and goals), by default
+// an embedded Universe takes no arguments.
+func WithArgs(args ...string) Option { return func(x *Universe) { x.args = args } }
+
+// WithStdout sends the standard output of the Universe to w.
+func WithStdout(w io.Writer) Option { return func(x *Universe) { x.stdout = w } }
+
+// WithStderr sends the diagnostics of the Universe to w.
+func WithStderr(w io.Writer) Option { return func(x *Universe) { x.stderr = w } }
+
+// WithHooks installs hooks to intercept asserts, debug and error messages.
+func WithHooks(h Hooks) Option { return func(x *Universe) { x.hooks = h } }
+
+// WithStdin reads the commands of -debug-vm-step and the lines of -repl from
+// r instead of os.Stdin.
+func WithStdin(r io.Reader) Option { return func(x *Universe) { x.stdin = r } }
+
+// A Universe embeds smart in a Go program: it loads a work directory like
+// the smart command does, lists its projects, rules and defs, evaluates
+// expressions and runs goals. Outputs of universes are serialized.
+type Universe struct {
+	u *universe
+	workdir string
+	args    []string
+	hooks   Hooks
+	stdin   io.Reader
+	stdout, stderr io.Writer
+}
+
+// New creates a Universe configured by the options.
+func New(opts ...Option) *Universe {
+	var x = &Universe{args: []string{}}
+	for _, opt := range opts { opt(x) }
+
+	var ii = []any{x.args, x.hooks.hooks()}
+	if x.stdin != nil { ii = append(ii, x.stdin) }
+	if x.workdir != "" {
+		if s, err := filepath.Abs(x.workdir); err == nil {
+			ii = append(ii, workdir_sym(intern(s)))
+		}
+	}
+	x.u = new_universe(ii...)
+	searchModules(x.u)
+	return x
+}
+
+// recover converts a panic of the engine into err, it must be deferred.
+func (x *Universe) recover(err *error) {
+	switch e := recover().(type) {
+	case nil:
+	case unwind_errors: *err = fmt.Errorf("%d errors", e.int)
+	case error: *err = e
+	default: *err = fmt.Errorf("%v", e)
+	}
+}
+
+// errors returns the number of errors reported since the count of n0.
+func (x *Universe) errors(n0 int) int {
+	x.u.flush(x.u)
+	x.u.diagnostic.Lock(); defer x.u.diagnostic.Unlock()
+	return x.u.erros - n0
+}
+
+func (x *Universe) redirect() func() {
+	var restore = redirect(x.stdout, x.stderr)
+	return func() { x.u.flush(x.u); restore() }
+}
+
+// Close flushes the diagnostics and closes the -diag-output file.
+func (x *Universe) Close() (err error) {
+	defer x.redirect()()
+	defer x.recover(&err)
+	x.u.teardown()
+	return
+}
+
+// Load loads the projects of the work directory.
+func (x *Universe) Load() (err error) {
+	defer x.redirect()()
+	defer x.recover(&err)
+	if x.u.load(main_ctx{x.u}); x.u.globe.main == nil {
+		err = errors.New("no project loaded")
+	} else if n := x.errors(0); n > 0 {
+		err = fmt.Errorf("loading work got %d errors", n)
+	}
+	return
+}
+
+func (x *Universe) project(name string) *project {
+	if name == "" { return x.u.globe.main }
+	for _, p := range x.u.globe.loadedProjs {
+		if s := intern(name); p.name == s || p.spec == s { return p }
+	}
+	return nil
+}
+
+// Projects returns the names of the loaded projects in loading order.
+func (x *Universe) Projects() (names []string) {
+	for _, p := range x.u.globe.loadedProjs {
+		names = append(names, p.name.String())
+	}
+	return
+}
+
+// Rules returns the targets of the rules of a project, the main project
+// if name is empty.
+func (x *Universe) Rules(name string) (targets []string) {
+	var p = x.project(name)
+	if p == nil { return }
+	var seen = make(map[*rule]bool)
+	p.entries.each(func(a any) {
+		if r, ok := a.(*rule); ok && !seen[r] {
+			seen[r] = true
+			targets = append(targets, __string(x.u, r.target))
+		}
+	})
+	return
+}
+
+// Defs returns the evaluated defs of a project, the main project if name
+// is empty.
+func (x *Universe) Defs(name string) (defs map[string]string, err error) {
+	var p = x.project(name)
+	if p == nil { return nil, fmt.Errorf("%s: no such project", name) }
+
+	defer x.redirect()()
+	defer x.recover(&err)
+
+	var c = closure_with(main_ctx{x.u}, p.scope)
+	defs = make(map[string]string)
+	for sym, o := range p.scope.copyElems() {
+		if d, ok := o.(*def); ok {
+			var s string
+			if d.value != nil { s = strings.TrimSpace(__string(c, d.value)) }
+			defs[sym.String()] = s
+		}
+	}
+	return
+}
+
+// Eval evaluates an expression like `$(foo) bar` in the scope of the main
+// project and returns the result as a string.
+func (x *Universe) Eval(expr string) (res string, err error) {
+	var p = x.u.globe.main
+	if p == nil { return "", errors.New("no project loaded") }
+
+	defer x.redirect()()
+	defer x.recover(&err)
+
+	var n0 = x.errors(0)
+	var c = closure_with(main_ctx{x.u}, p.scope)
+	var cc = compiler{
+		symstr: &symstr{Context: &term{c, p.scope}},
+		compilestate: compilestate{project: p},
+	}
+	if v := cc.text(p.absPath, expr); v != nil {
+		res = strings.TrimSpace(__string(c, v))
+	}
+	if n := x.errors(n0); n > 0 {
+		err = fmt.Errorf("eval work got %d errors", n)
+	}
+	return
+}
+
+// Run updates the goals (the main entry if none) of the main project, it
+// stops running commands when ctx is done.
+func (x *Universe) Run(ctx context.Context, goals ...string) (results []string, err error) {
+	if x.u.globe.main == nil { return nil, errors.New("no project loaded") }
+	if err = ctx.Err(); err != nil { return }
+
+	defer x.redirect()()
+	defer x.recover(&err)
+
+	var u = x.u
+	if len(goals) > 0 {
+		u.globe.goals.value = _null(NoPos)
+		for _, g := range goals { u.globe.goals.append(u, _word(NoPos, intern(g))) }
+	}
+
+	u.runctx = ctx
+	defer func() { u.runctx = nil }()
+
+	var n0 = x.errors(0)
+	for _, v := range u.run(main_ctx{u}) { // the recipes are run by __string
+		if v != nil { results = append(results, strings.TrimSpace(__string(u, v))) }
+	}
+	if err = ctx.Err(); err != nil {
+		results = nil
+	} else if n := x.errors(n0); n > 0 {
+		results, err = nil, fmt.Errorf("run work got %d errors", n)
+	}
+	return
+}
+
 type searched_path struct{ sym Symbol ; isDir bool }
 type search_path struct{ sym Symbol }
 type searchlist []Symbol
@@ -33799,6 +36268,15 @@ type universe struct {
     prefix  string // FIXME: prefix for distribution
 	workdir Symbol // FIXME: restore workdir for loading
     paths   searchlist
+    args    []string // command line arguments, os.Args[1:] by default
+    runctx  context.Context // cancels commands of an embedded Run
+    stdin   io.Reader // input of the VM stepper (see vmdebugger), os.Stdin by default
+    vmdebug vmdebugger
+    matchers usermatchers // $(matcher)
+    langs   userlangs // $(langinfo)
+    runs    *runstate // of the current run
+    stamped stamps // see stampFile
+    jobserver jobserver // see startJobserver
 
     statmutex sync.Mutex
 	statcache sync.Map // FIXED: Replaces map[Symbol]*filebase for lock-free scaling
@@ -33818,6 +36296,16 @@ func (ctx *universe) _position() (p Position) {
     return
 }
 
+// toolchainVar returns the value of a toolchain variable (see toolchainVars)
+// if a toolchain profile is selected, or an empty string.
+func (u *universe) toolchainVar(ctx Context, name string) (s string) {
+	if u.toolchain == "" || u.globe == nil { return }
+	if d, _ := u.globe.scope.lookup(intern(name)).(*def); d != nil && d.value != nil {
+		s = strings.TrimSpace(__string(ctx, d.value))
+	}
+	return
+}
+
 func (ctx *universe) trimFileSpec(c Context, spec Symbol) Symbol {
 	if spec == symEmpty {
 		return symEmpty
@@ -33910,7 +36398,7 @@ func (u *universe) do(ctx Context, op any) (res any) {
 	case get_project:
 		if u.globe != nil { return u.globe.main }
 	case exec_noop:
-		if u.noExec { return u.noExec }
+		if u.noExec || u.dryRun { return true }
 	case is_test_mode:
 		if u.testMode { return true }
 
@@ -34034,6 +36522,13 @@ type commandline struct {
     debugInfos      bool `di,dbinfo,debug-infos`
     debugPrompt     bool `dp,dbprom,debug-prompt`
     debugSyntax []string `ds,dbsyntax,debug-syntax`
+    debugVM         bool `dvm,debug-vm` // trace symstr VM steps
+    debugVMStep     bool `dvms,debug-vm-step` // step symstr VMs interactively
+    diagFormat      string `diag-format` // json, sarif
+    diagOutput      string `diag-output` // file of -diag-format (default stderr)
+    maxErrors       int `max-errors` // stop after N errors, negative for no limit
+    werror          bool `Werror,werror` // warnings are errors
+    noWarn          []Value `no-warn` // -no-warn(CATEGORY ...), "all" for every warning
 
     profile         bool `profile`
     cpuProfile      string `cpu-profile`
@@ -34064,19 +36559,42 @@ type commandline struct {
     checkLoadGraph  bool `ckld,check-loads`
 
     reconfigure     bool `rc,reconf,reconfig,reconfigure`
+    toolchain       string `toolchain` // -toolchain=NAME selects .smart/toolchains/NAME
+    configShow      bool `config-show`
+    configSet       []Value `config-set` // -config-set NAME=VALUE, -config-set(NAME=VALUE ...)
+    configUnset     []Value `config-unset` // -config-unset NAME, -config-unset(NAME ...)
 
     saveGrepSource  bool `savgs,save-grep-source`
 
+    sandbox         bool `sandbox`
+    sandboxHelper   string `sandbox-helper` // bwrap
+    sandboxAllow    []Value `sandbox-allow` // -sandbox-allow(PATH ...)
+    traceInputs     bool `trace-inputs`
+    traceRecord     bool `trace-inputs-record`
+    traceHelper     string `trace-helper` // strace
+    grepCacheStats  bool `grep-cache-stats`
+    grepCacheDump   []Value `grep-cache-dump` // -grep-cache-dump(TARGET ...)
+
     noRun           bool `nor,no-run`
     noExec          bool `nox,ne,no-exec,no-execute`  // optionNoExec
+    dryRun          bool `n,dry,dry-run,just-print` // -no-exec printing the recipes
+    clean           bool `clean`
+    deleteOnError   bool `delete-on-error`
+    autoIntermediate bool `auto-intermediate` // see chained
+    distclean       bool `distclean`
     noDeps          bool `nod,no-deps`
     noGrep          bool `nog,no-grep`
     noDepsGrep      bool `nodg,ngd,no-deps-grep,no-grep-deps`
     noImportFiles   bool `noif,no-import-files`
 
     parallel        bool `par,para,parallel`
+    jobs            int `j,jobs` // jobserver slots, see startJobserver
+    jobserverStyle  string `jobserver-style` // fifo, pipe
 
     testMode        bool `test,test-mode`
+    testKeep        bool `tk,test-keep`
+    replMode        bool `repl`
+    junitXml        string `junit,junit-xml`
     fastMode        bool `fast,fast-mode`
     errorUncache    bool `eu,error-uncache,error-no-cache`
     panicFailureOnFlushedErrors bool `foe,fail-on-errors`
@@ -34103,6 +36621,9 @@ func _commandline() commandline { return commandline{
     panicFailureOnFlushedErrors: true,
     silentOptionalArrow: false,
 
+    sandboxHelper: "bwrap",
+    traceHelper: "strace",
+
     slow: 2999 * time_pkg.Millisecond,
 }}
 
@@ -34115,11 +36636,15 @@ func isGlobeScope(s *scope) bool {
 
 func new_universe(ii ...any) (ctx *universe) {
 	ctx = &universe{
+		diagnostic: diagnostic{ctl: new(diagcontrol)},
+		runs:       new(runstate),
 		launchTime: time_pkg.Now(),
 		// FIXED: sync.Map does not use make(). Initialize explicitly as a blank composite struct literal.
 		statcache:  sync.Map{},
 		fset:       new_fileset(),
 		workdir:    symBaseWorkDir,
+		args:       os.Args[1:],
+		stdin:      os.Stdin,
 	}
 
 	cl := true
@@ -34130,6 +36655,8 @@ func new_universe(ii ...any) (ctx *universe) {
 		case  commandline: ctx.commandline, cl =  t, false
 		case *commandline: ctx.commandline, cl = *t, false
 		case  workdir_sym: ctx.workdir = Symbol(t)
+		case  []string:    ctx.args = t
+		case  io.Reader:   ctx.stdin = t
 		}
 	}
 	if cl { ctx.commandline = _commandline() }
@@ -34137,7 +36664,7 @@ func new_universe(ii ...any) (ctx *universe) {
 	// Bootstrap top-level AST arguments
 	ctx.scope = new_scope(ctx, nil, nil, symUniverse)
 	ctx.scope.def(ctx, defVoid, symSMART, ease(ctx, os.Args[0]))
-	ctx.scope.def(ctx, defVoid, symSMART_ARGS, ease(ctx, os.Args[1:]))
+	ctx.scope.def(ctx, defVoid, symSMART_ARGS, ease(ctx, ctx.args))
 
 	// Pre-register all builtin functions
 	for name, m := range builtins {
@@ -34266,8 +36793,6 @@ func (u *universe) load(ctx Context) {
 
 	_ = baseTmpPath(ctx, u.workdir) // Once-bind symBaseTmpPath to the workdir
 
-	if false { loadGrepCache(ctx) }
-
 	// 1. VFS Pre-Warm / Sanity Check (Replaces dead os.Stat code)
 	// We use pure Walled Garden pathing and cache lookups!
 	if mainSym := _stat(ctx, __symPathJoin(u.workdir, symMainFileName)); mainSym == nil || !mainSym.exists() {
@@ -34279,7 +36804,7 @@ func (u *universe) load(ctx Context) {
 
 	// 2. Extract engine arguments (Shielded from Go Test flags)
 	var engineArgs []string
-	for _, arg := range os.Args[1:] {
+	for _, arg := range u.args {
 		// THE DOD FIX: Block Go test flags from entering the Smart AST Compiler!
 		if !strings.HasPrefix(arg, "-test.") {
 			engineArgs = append(engineArgs, arg)
@@ -34299,6 +36824,8 @@ func (u *universe) load(ctx Context) {
 	}
 	top.parseArgs(ctx, engineArgs)
 
+	if u.toolchain != "" { top.toolchain(ctx, u.toolchain) }
+
 	if u.profile {
 		// 3. The Airlock: Extract the string exactly once for physical OS file creation
 		cpuProfStr := __symPathJoin(u.workdir, intern("load.cpu.auto.prof")).String()
@@ -34361,6 +36888,7 @@ func (u *universe) load(ctx Context) {
 
 func (u *universe) run(ctx Context) (result []Value) {
 	if u.noRun { return }
+	u.runs = new(runstate)
 
 	var main = u.globe.main
 	if main == nil {
@@ -34479,6 +37007,7 @@ func (u *universe) run(ctx Context) (result []Value) {
 		if len(goals) > 0 {
 			// Stream all targeted goals sequentially into the native evoke pipeline
 			for _, goal := range goals {
+				if u.runctx != nil && u.runctx.Err() != nil { break }
 				sym := __symbol(ctx, goal.value)
 				args, _ := u.globe.args[sym]
 
@@ -34487,11 +37016,710 @@ func (u *universe) run(ctx Context) (result []Value) {
 					result = append(result, unpack(v)...)
 				}
 			}
+			u.removeIntermediates(ctx)
+		}
+	}
+	return
+}
+
+type teststatus uint8
+
+const (
+	testPassed teststatus = iota
+	testFailed
+	testSkipped
+)
+
+func (s teststatus) String() string {
+	switch s {
+	case testPassed:  return "PASS"
+	case testFailed:  return "FAIL"
+	case testSkipped: return "SKIP"
+	}
+	return "????"
+}
+
+type testfailure struct{ position Position ; message string }
+
+// A testcase is a `test-*` rule picked up by `smart -test`.
+type testcase struct {
+	project *project
+	entry   matched_rule
+	name    string
+	workdir Symbol
+	status  teststatus
+	reason  string
+	elapsed time_pkg.Duration
+	failures []testfailure
+}
+
+type test_skipped struct{ position Position ; reason string }
+
+type testcase_ctx struct{ Context ; t *testcase }
+func (c testcase_ctx) do(ctx Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return c.Context
+	case dynamic_cast: return t.ctx(c, c.Context)
+	case is_test_case: return c.t
+	case is_test_mode: return true
+	}
+	return c.Context.do(ctx, op)
+}
+
+// each visits the payloads of the cache in the order they were added.
+func (c *valcache) each(f func(a any)) {
+	for _, a := range c.a { f(a) }
+	for _, n := range c.o { n.v.each(f) }
+}
+
+// config edits the cached configuration (configuration.sm) of the loaded
+// projects: -config-set pins values, -config-unset drops them so they're
+// probed again, -config-show lists the configs. It returns the number of
+// errors.
+func (u *universe) config(ctx Context) (errs int) {
+	var erros = u.erros // the errors may be flushed as they're reported
+	var target = func(a Value) (proj *project, name Symbol) {
+		var s = __string(ctx, a)
+		if i := strings.IndexByte(s, '.'); i > 0 {
+			for _, p := range u.globe.loadedProjs {
+				if p.name.String() == s[:i] { return p, intern(s[i+1:]) }
+			}
+		}
+		return u.globe.main, intern(s)
+	}
+
+	var changed []*project
+	var change = func(proj *project) {
+		for _, p := range changed { if p == proj { return } }
+		changed = append(changed, proj)
+	}
+
+	for _, a := range merge(u.configSet...) {
+		kv, ok := unloc(a).(*pair)
+		if !ok {
+			erro(pc(ctx,a), "-config-set: expects NAME=VALUE: %v", a)
+			continue
+		}
+		proj, name := target(kv.key)
+		if proj == nil || name == symEmpty {
+			erro(pc(ctx,a), "-config-set: no project for %v", kv.key)
+			continue
+		}
+		d, isNew, _ := proj._def(ctx, defConfig, name)
+		if d == nil {
+			erro(pc(ctx,a), "-config-set: %v: can't define %v", proj.name, name)
+			continue
+		} else if isNew {
+			proj.configs = append(proj.configs, d)
+		}
+		d.value = nil
+		d.set(ctx, kv.val)
+		proj.probe(name).pinned = true
+		change(proj)
+	}
+
+	for _, a := range merge(u.configUnset...) {
+		proj, name := target(a)
+		if proj == nil { continue }
+
+		var configs []*def
+		for _, d := range proj.configs {
+			if d.name != name { configs = append(configs, d) }
+		}
+		if len(configs) == len(proj.configs) {
+			warn(pc(ctx,a), "-config-unset: %v: no config %v", proj.name, name)
+			continue
+		}
+		proj.configs = configs
+		delete(proj.probes, name)
+		change(proj)
+	}
+
+	for _, proj := range changed {
+		var f = proj.configuration_sm(ctx)
+		if f == nil { continue }
+
+		var fn = f.fullname().String()
+		if e := os.MkdirAll(filepath.Dir(fn), os.FileMode(0755)); e != nil {
+			erro(ctx, "%v: %v", proj.name, e)
+		} else if e = os.WriteFile(fn+".tmp", proj.serializeConfiguration(), 0600); e != nil {
+			erro(ctx, "%v: %v", proj.name, e)
+		} else if e = os.Rename(fn+".tmp", fn); e != nil {
+			erro(ctx, "%v: %v", proj.name, e)
+		} else {
+			f.stat(ctx, false)
+			prompt(ctx, "%v: updated %v\n", proj.name, fn)
+		}
+	}
+
+	if u.configShow {
+		for _, proj := range u.globe.loadedProjs {
+			if len(proj.configs) == 0 { continue }
+
+			var width int
+			for _, d := range proj.configs {
+				if n := len(d.name.String()); n > width { width = n }
+			}
+
+			if f := proj.configuration_sm(ctx); f != nil {
+				prompt(ctx, "%v (%v)\n", proj.name, f.fullname())
+			} else {
+				prompt(ctx, "%v\n", proj.name)
+			}
+			for _, d := range proj.configs {
+				var val string
+				if d.value != nil && !isTrivial(d.value) { val = d.value.String() }
+
+				var notes []string
+				if x := proj.probes[d.name]; x != nil {
+					if x.pos.valid() { notes = append(notes, u.fset.Position(x.pos).String()) }
+					for _, op := range x.ops { notes = append(notes, "-"+op.String()) }
+					if x.pinned { notes = append(notes, "pinned") }
+				}
+				if len(notes) == 0 {
+					prompt(ctx, "  %-*s = %s\n", width, d.name, val)
+				} else {
+					prompt(ctx, "  %-*s = %s  # %s\n", width, d.name, val, strings.Join(notes, ", "))
+				}
+			}
+		}
+	}
+	flush(ctx)
+	return u.erros - erros
+}
+
+// tests discovers `test-*` rules of all loaded projects, goals given on the
+// command line are taken as name patterns to select from them.
+func (u *universe) tests(ctx Context) (tests []*testcase) {
+	var patterns []string
+	for _, g := range merge(u.globe.goals.value) {
+		if s := __string(ctx, g); s != "" { patterns = append(patterns, s) }
+	}
+
+	var seen = make(map[*rule]bool)
+	for _, proj := range u.globe.loadedProjs {
+		proj.entries.each(func(a any) {
+			r, ok := a.(*rule)
+			if !ok || seen[r] { return }
+
+			var name = __string(ctx, r.target)
+			if !strings.HasPrefix(name, "test-") || strings.ContainsAny(name, "%*?") {
+				return
+			}
+
+			var selected = len(patterns) == 0
+			for _, pat := range patterns {
+				if ok, _ := filepath.Match(pat, name); ok { selected = true; break }
+			}
+			if selected {
+				seen[r] = true
+				tests = append(tests, &testcase{
+					project: proj,
+					entry:   matched_rule{r, r.target},
+					name:    name,
+				})
+			}
+		})
+	}
+	return
+}
+
+// test runs each discovered test rule in a temporary work directory and
+// reports the outcome, it returns the number of failed tests.
+func (u *universe) test(ctx Context) (failed int) {
+	var tests = u.tests(ctx)
+	if len(tests) == 0 {
+		prompt(ctx, "no test rules (test-*) found\n")
+		flush(ctx)
+		return
+	}
+
+	var assert = u.hooks.assert
+	defer func() { u.hooks.assert = assert }()
+
+	u.hooks.assert = func(c Context, v Value, y bool) bool {
+		tc, _ := do(c, is_test_case{}).(*testcase)
+		if tc == nil {
+			return assert != nil && assert(c, v, y)
+		}
+		if y || assert != nil && assert(c, v, y) {
+			return true
+		}
+		var s = "assert"
+		if v != nil { s = fmt.Sprintf("assert: %v → '%s'", v, __string(c, v)) }
+		tc.failures = append(tc.failures, testfailure{_position(c), s})
+		return true
+	}
+
+	var passed, skipped int
+	for _, t := range tests {
+		if u.test1(ctx, t); u.verbose || t.status != testPassed {
+			prompt(ctx, "--- %v  %s: %s (%.2fs)\n", t.status, t.project.name, t.name, t.elapsed.Seconds())
+		}
+		if t.reason != "" {
+			prompt(ctx, "    %s\n", t.reason)
+		}
+		for _, f := range t.failures {
+			prompt(ctx, "    %v: %s\n", f.position, f.message)
+		}
+		switch t.status {
+		case testPassed:  passed  += 1
+		case testFailed:  failed  += 1
+		case testSkipped: skipped += 1
+		}
+	}
+
+	prompt(ctx, "tests: %d passed, %d failed, %d skipped\n", passed, failed, skipped)
+
+	if u.junitXml != "" {
+		if err := writeJUnit(u.junitXml, tests); err != nil {
+			erro(ctx, "%s: %v", u.junitXml, err)
+		}
+	}
+	flush(ctx)
+	return
+}
+
+func (u *universe) test1(ctx Context, t *testcase) {
+	var dir string
+	if s := t.project.tempdirSym(ctx); s != symEmpty {
+		dir = filepath.Join(s.String(), ".test", t.name)
+		if err := os.RemoveAll(dir); err == nil {
+			err = os.MkdirAll(dir, 0755)
+		}
+	}
+	if dir == "" {
+		dir, _ = os.MkdirTemp("", "smart-"+t.name+"-")
+	}
+	if dir != "" {
+		t.workdir = intern(dir)
+	}
+
+	if u.verbose { prompt(ctx, "=== RUN   %s: %s\n", t.project.name, t.name) }
+
+	flush(ctx) // so that errors are counted per test
+	var start = time_pkg.Now()
+	func() {
+		defer func() {
+			switch e := recover().(type) {
+			case nil:
+			case test_skipped:
+				t.status, t.reason = testSkipped, e.reason
+				if e.position.valid() { t.reason = fmt.Sprintf("%v: %s", e.position, e.reason) }
+			case traverse_state:
+				// Leaving the rule early is not a failure.
+			case failure:
+				t.status, t.reason = testFailed, e.reason
+			case error:
+				t.status, t.reason = testFailed, e.Error()
+			default:
+				t.status, t.reason = testFailed, fmt.Sprintf("%v", e)
+			}
+		}()
+		var c = closure_with(ctx, t.project.scope)
+		var v Value = t.entry
+		if args := u.globe.args[__symbol(ctx, t.entry.value)]; len(args) > 0 {
+			v = &argumented{v, args}
+		}
+		traverse(testcase_ctx{c, t}, v) // runs the recipes like a goal
+	}()
+	t.elapsed = time_pkg.Since(start)
+
+	if errs := flush(ctx); errs > 0 && t.status != testSkipped {
+		t.status = testFailed
+		if t.reason == "" { t.reason = fmt.Sprintf("%d errors", errs) }
+	}
+	if len(t.failures) > 0 && t.status != testSkipped {
+		t.status = testFailed
+	}
+	if dir != "" && t.status != testFailed && !u.testKeep {
+		os.RemoveAll(dir)
+	}
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitFailure `xml:"skipped,omitempty"`
+}
+
+type junitTestsuite struct {
+	XMLName  enc_xml.Name    `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+type junitTestsuites struct {
+	XMLName enc_xml.Name     `xml:"testsuites"`
+	Suites  []junitTestsuite `xml:"testsuite"`
+}
+
+// writeJUnit writes the test results in the JUnit XML format used by
+// most CI systems, one testsuite per project.
+func writeJUnit(filename string, tests []*testcase) error {
+	var doc junitTestsuites
+	var suites = make(map[*project]int)
+	var elapsed = make(map[*project]time_pkg.Duration)
+	for _, t := range tests {
+		i, ok := suites[t.project]
+		if !ok {
+			i = len(doc.Suites)
+			suites[t.project] = i
+			doc.Suites = append(doc.Suites, junitTestsuite{Name: t.project.name.String()})
+		}
+
+		var s = &doc.Suites[i]
+		var c = junitTestcase{
+			Name:      t.name,
+			Classname: t.project.name.String(),
+			Time:      fmt.Sprintf("%.3f", t.elapsed.Seconds()),
+		}
+		switch t.status {
+		case testFailed:
+			var sb strings.Builder
+			for _, f := range t.failures {
+				fmt.Fprintf(&sb, "%v: %s\n", f.position, f.message)
+			}
+			var msg = t.reason
+			if msg == "" && len(t.failures) > 0 { msg = t.failures[0].message }
+			c.Failure = &junitFailure{Message: msg, Text: sb.String()}
+			s.Failures += 1
+		case testSkipped:
+			c.Skipped = &junitFailure{Message: t.reason}
+			s.Skipped += 1
+		}
+		s.Tests += 1
+		s.Cases = append(s.Cases, c)
+		elapsed[t.project] += t.elapsed
+	}
+	for p, i := range suites {
+		doc.Suites[i].Time = fmt.Sprintf("%.3f", elapsed[p].Seconds())
+	}
+
+	b, err := enc_xml.MarshalIndent(doc, "", "  ")
+	if err != nil { return err }
+	b = append([]byte(enc_xml.Header), append(b, '\n')...)
+	return os.WriteFile(filename, b, 0644)
+}
+
+// repl_ctx compiles the statements typed in -repl as a flat file of the
+// main project (i.e. without the `project` clause).
+type repl_ctx struct{ Context }
+func (c repl_ctx) do(ctx Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return c.Context
+	case dynamic_cast: return t.ctx(c, c.Context)
+	case is_flat_mode: return true
+	}
+	return c.Context.do(ctx, op)
+}
+
+const replHelp = `:help             show this help
+:names [PREFIX]   list the names in scope (what tab completes)
+:quit             leave the repl (or ^D)
+
+NAME = VALUE, rules (a: b ; recipe) and keyword clauses are compiled into the
+main project, (modifier ...) and {(modifier ...) ...} apply the modifiers,
+anything else is evaluated and printed as 'type value' lines. A trailing \
+continues the line.
+`
+
+// repl reads statements and expressions from the terminal and evaluates
+// them in the main project (-repl).
+func (u *universe) repl(ctx Context) {
+	var m = u.globe.main
+	if m == nil {
+		erro(ctx, "-repl: no main project")
+		return
+	}
+
+	var p = &compiler{symstr: &symstr{Context: &term{ctx, m.scope}}}
+	p.project = m
+
+	var ed = newLineEditor(u.stdin, joinTmpPath(ctx, symEmpty, intern("repl.history")).String(),
+		func(prefix string) []string { return u.replNames(m, prefix) })
+	defer ed.close()
+
+	fmt.Fprintf(stdout, "smart %v (%s), :help for help\n", m.name, m.absPath)
+	for n := 1; ; n++ {
+		line, ok := ed.readLine(m.name.String() + "> ")
+		for ok && strings.HasSuffix(line, "\\") {
+			var more string
+			if more, ok = ed.readLine("... "); ok {
+				line += "\n" + more
+			}
+		}
+		if !ok { return }
+
+		switch s := strings.TrimSpace(line); {
+		case s == "":
+		case s == ":q" || s == ":quit":
+			return
+		case s == ":h" || s == ":help":
+			fmt.Fprint(stdout, replHelp)
+		case strings.HasPrefix(s, ":names"):
+			var names = u.replNames(m, strings.TrimSpace(strings.TrimPrefix(s, ":names")))
+			fmt.Fprintf(stdout, "%s\n", strings.Join(names, " "))
+		case strings.HasPrefix(s, ":"):
+			erro(ctx, "-repl: unknown command %s (see :help)", s)
+		default:
+			u.replEval(p, intern(fmt.Sprintf("<repl:%d>", n)), s)
+		}
+		flush(ctx)
+	}
+}
+
+// replEval compiles a statement or evaluates an expression typed in -repl.
+func (u *universe) replEval(p *compiler, filename Symbol, s string) {
+	defer func(c Context, state compilestate) {
+		if e := recover(); e != nil {
+			if _, y := e.(unwind_errors); !y { erro(c, "%v", e) }
 		}
+		p.Context, p.compilestate = c, state
+	} (p.Context, p.compilestate)
+
+	if u.replIsStatement(p, filename, s) {
+		p.Context = repl_ctx{p.Context}
+		p.source(filename, []byte(s+"\n"))
+		return
 	}
+
+	var results []Value
+	switch t := p.text(filename, s+"\n").(type) {
+	case *modification:
+		for _, m := range t.list {
+			if v := modify(p, &m.group, true); !is(v, KindNull) { results = append(results, v) }
+		}
+	case *group:
+		if len(t.elems) > 0 && modifiers[__symbol(p, t.elems[0])] != nil {
+			if v := modify(p, t, true); !is(v, KindNull) { results = append(results, v) }
+		} else {
+			results = p.evals(t)
+		}
+	case Value:
+		results = p.evals(t)
+	}
+
+	if flush(p) == 0 {
+		for _, v := range merge(results...) {
+			fmt.Fprintf(stdout, "%s %s\n", typeof(v), __string(p, v))
+		}
+	}
+}
+
+// replIsStatement parses s like a clause (see compiler.clause) to tell
+// definitions, rules and keyword clauses from the expressions: they start
+// with a keyword, or an assignment or a rule delimiter follows the leading
+// expressions. A rule delimiter must also stop s parsed as expressions, the
+// `:` of a URL is part of its expression.
+func (u *universe) replIsStatement(p *compiler, filename Symbol, s string) bool {
+	defer func(c Context, sc scanner, state compilestate) {
+		p.Context, p.scanner, p.compilestate = c, sc, state
+	} (p.Context, p.scanner, p.compilestate)
+
+	var text = []byte(s+"\n")
+	var delim = func(lhs bool) token {
+		p.scanner.init(p, u.fset.add(filename, len(text)), text, 0)
+		if p.next(true); p.tok.is_keyword() && p.tok < UNDEF { return p.tok }
+		for p.tok != LINEND && p.tok != EOF {
+			var c = p.Context
+			if lhs { p.Context = left_side_ctx{c} }
+			p.expr()
+			p.Context = c
+			if p.spaces(); p.tok.is_assign() || p.tok.is_rule_delim() { return p.tok }
+		}
+		return EOF
+	}
+
+	switch t := delim(true); {
+	case t == EOF: return false
+	case t.is_rule_delim(): return delim(false) != EOF
+	}
+	return true
+}
+
+// replNames lists the builtins, modifiers, keywords, defs and rules visible
+// in the main project that start with prefix.
+func (u *universe) replNames(m *project, prefix string) (names []string) {
+	var seen = make(map[string]bool)
+	var add = func(s string) {
+		if s != "" && !seen[s] && strings.HasPrefix(s, prefix) {
+			seen[s] = true
+			names = append(names, s)
+		}
+	}
+	for sym := range builtins { add(sym.String()) }
+	for sym := range modifiers { add(sym.String()) }
+	for sym, t := range keywords { if t < UNDEF { add(sym.String()) } }
+	for s := m.scope; s != nil; s = s.outer {
+		for _, sym := range s.names() { add(sym.String()) }
+	}
+	m.entries.each(func(a any) {
+		if r, ok := a.(*rule); ok { add(__string(u, r.target)) }
+	})
+	sort.Strings(names)
 	return
 }
 
+// lineeditor reads the lines of -repl with history and tab completion. The
+// terminal is switched to non-canonical mode by stty(1), if the input is not
+// a terminal (e.g. a pipe or WithStdin) the lines are read as they are.
+type lineeditor struct {
+	in *bufio.Reader
+	term *os.File // the input if it's a terminal
+	tty string // saved `stty -g` state, empty if not a terminal
+	history []string
+	histfile string
+	complete func(prefix string) []string
+}
+
+func newLineEditor(r io.Reader, histfile string, complete func(string) []string) *lineeditor {
+	var ed = &lineeditor{in: bufio.NewReader(r), histfile: histfile, complete: complete}
+	if b, err := os.ReadFile(histfile); err == nil {
+		for _, s := range strings.Split(string(b), "\n") {
+			if s != "" { ed.history = append(ed.history, s) }
+		}
+	}
+	if f, ok := r.(*os.File); !ok {
+		// not a terminal
+	} else if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		ed.term = f
+		if s, err := ed.stty("-g"); err == nil {
+			if _, err = ed.stty("-icanon", "-echo", "-isig", "min", "1"); err == nil {
+				ed.tty = strings.TrimSpace(s)
+			}
+		}
+	}
+	return ed
+}
+
+func (ed *lineeditor) stty(args ...string) (string, error) {
+	if ed.term == nil { return "", errors.New("stty: not a terminal") }
+	var c = exec.Command("stty", args...)
+	c.Stdin = ed.term
+	b, err := c.Output()
+	return string(b), err
+}
+
+func (ed *lineeditor) close() {
+	if ed.tty == "" { return }
+	ed.stty(ed.tty)
+	if n := len(ed.history); n > 500 { ed.history = ed.history[n-500:] }
+	if len(ed.history) > 0 && os.MkdirAll(filepath.Dir(ed.histfile), os.FileMode(0755)) == nil {
+		os.WriteFile(ed.histfile, []byte(strings.Join(ed.history, "\n")+"\n"), 0600)
+	}
+}
+
+// readLine reads a line after writing the prompt, ok is false at the end
+// of input (or ^D on an empty line).
+func (ed *lineeditor) readLine(prompt string) (line string, ok bool) {
+	fmt.Fprint(stdout, prompt)
+	if ed.tty == "" {
+		s, err := ed.in.ReadString('\n')
+		if err != nil && s == "" { return "", false }
+		return strings.TrimRight(s, "\r\n"), true
+	}
+
+	var buf []rune
+	var pos, tabs, hist = 0, 0, len(ed.history)
+	var redraw = func() {
+		fmt.Fprintf(stdout, "\r\x1b[K%s%s", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 { fmt.Fprintf(stdout, "\x1b[%dD", n) }
+	}
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil { return "", false }
+		if r != '\t' { tabs = 0 }
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(stdout, "\n")
+			line = string(buf)
+			if n := len(ed.history); line != "" && (n == 0 || ed.history[n-1] != line) {
+				ed.history = append(ed.history, line)
+			}
+			return line, true
+		case 4: // ^D
+			if len(buf) == 0 {
+				fmt.Fprint(stdout, "\n")
+				return "", false
+			}
+		case 3: // ^C
+			fmt.Fprint(stdout, "^C\n")
+			buf, pos, hist = nil, 0, len(ed.history)
+			redraw()
+		case 127, 8: // backspace
+			if pos > 0 {
+				buf, pos = append(buf[:pos-1], buf[pos:]...), pos-1
+				redraw()
+			}
+		case 1: pos = 0; redraw() // ^A
+		case 5: pos = len(buf); redraw() // ^E
+		case 21: buf, pos = buf[pos:], 0; redraw() // ^U
+		case '\t':
+			tabs++
+			buf, pos = ed.completion(buf, pos, tabs > 1)
+			redraw()
+		case 27: // ESC [ A..D (arrows), H, F
+			if b, _ := ed.in.ReadByte(); b != '[' && b != 'O' { continue }
+			switch b, _ := ed.in.ReadByte(); b {
+			case 'A':
+				if hist > 0 { hist--; buf = []rune(ed.history[hist]); pos = len(buf) }
+			case 'B':
+				if hist < len(ed.history) { hist++ }
+				if hist < len(ed.history) { buf = []rune(ed.history[hist]) } else { buf = nil }
+				pos = len(buf)
+			case 'C': if pos < len(buf) { pos++ }
+			case 'D': if pos > 0 { pos-- }
+			case 'H': pos = 0
+			case 'F': pos = len(buf)
+			}
+			redraw()
+		default:
+			if r >= ' ' {
+				buf, pos = append(buf[:pos], append([]rune{r}, buf[pos:]...)...), pos+1
+				redraw()
+			}
+		}
+	}
+}
+
+// completion completes the word before the cursor to the longest common
+// prefix of the candidates, the candidates are listed if it's ambiguous
+// and list is set (the second tab).
+func (ed *lineeditor) completion(buf []rune, pos int, list bool) ([]rune, int) {
+	var beg = pos
+	for beg > 0 && !strings.ContainsRune(" \t$(){},:=;'\"", buf[beg-1]) { beg-- }
+
+	var word = string(buf[beg:pos])
+	var names = ed.complete(word)
+	if len(names) == 0 { return buf, pos }
+
+	var common = names[0]
+	for _, s := range names[1:] {
+		for !strings.HasPrefix(s, common) { common = common[:len(common)-1] }
+	}
+	if len(names) == 1 { common += " " }
+
+	if rest := []rune(strings.TrimPrefix(common, word)); len(rest) > 0 {
+		buf = append(buf[:pos:pos], append(rest, buf[pos:]...)...)
+		pos += len(rest)
+	} else if list {
+		fmt.Fprintf(stdout, "\n%s\n", strings.Join(names, "  "))
+	}
+	return buf, pos
+}
+
 // A globe represents a global execution context.
 type globe struct {
     *scope
@@ -34854,10 +38082,13 @@ var modifiers = map[Symbol]reflect.Type{
 	symTouch:       reflect.TypeOf((*modifier_touch)(nil)).Elem(),
 	symGrep:        reflect.TypeOf((*modifier_grep)(nil)).Elem(),
 	symExtractDeps: reflect.TypeOf((*modifier_extractdeps)(nil)).Elem(),
-	// symExtractConfiguration: reflect.TypeOf((*modifier_extractconfiguration)(nil)).Elem(),
+	symExtractConfiguration: reflect.TypeOf((*modifier_extractconfiguration)(nil)).Elem(),
 
 
 	symCopyFile:       reflect.TypeOf((*modifier_copyfile)(nil)).Elem(),
+	symDownload:       reflect.TypeOf((*modifier_download)(nil)).Elem(),
+	symExtract:        reflect.TypeOf((*modifier_extract)(nil)).Elem(),
+	symArchive:        reflect.TypeOf((*modifier_archive)(nil)).Elem(),
 	symWriteFile:      reflect.TypeOf((*modifier_writefile)(nil)).Elem(),
 	symReadFile:       reflect.TypeOf((*modifier_readfile)(nil)).Elem(),
 	symUpdateFile:     reflect.TypeOf((*modifier_updatefile)(nil)).Elem(),
@@ -34881,6 +38112,10 @@ var modifiers = map[Symbol]reflect.Type{
 
 	symBy:           reflect.TypeOf((*modifier_by)(nil)).Elem(),
 	symDirty:        reflect.TypeOf((*modifier_dirty)(nil)).Elem(),
+
+	symPrecious:     reflect.TypeOf((*modifier_precious)(nil)).Elem(),
+	symIntermediate: reflect.TypeOf((*modifier_intermediate)(nil)).Elem(),
+	symSecondary:    reflect.TypeOf((*modifier_secondary)(nil)).Elem(),
 }
 
 type is_modify struct{}
@@ -35521,121 +38756,468 @@ func parseDependList(ctx Context, dependList *list) (depends *list) {
     return
 }
 
+// langInfoT tells (grep) how to find dependencies of a language: user
+// and system regexes capture the names (the captures are joined), which
+// are resolved by trying the name and the name with suffixes in the grepped
+// file's directory and then the search dirs, see also $(langinfo).
 type langInfoT struct {
     rxs []*regexp.Regexp
     sys []*regexp.Regexp
+    blocks []*langblock // e.g. go's import ( ... )
+    dirs []string     // search dirs (relative to the project)
+    suffixes []string // e.g. ".py", tried after the name itself
+    dotted bool       // module names like '..a.b' (→ ../a/b)
+}
+
+// langblock is a group of lines such as go's `import ( ... )`, its regexes
+// only apply to the lines between begin and end.
+type langblock struct {
+    begin, end *regexp.Regexp
+    sys []*regexp.Regexp
 }
 
 var langInfos = map[string]*langInfoT{
     "asm": &langInfoT{
-        []*regexp.Regexp{
+        rxs: []*regexp.Regexp{
             regexp.MustCompile(`^\s*#\s*include\s*"(.+)".*$`),
         },
-        []*regexp.Regexp{
+        sys: []*regexp.Regexp{
             regexp.MustCompile(`^\s*#\s*include\s*<(.+)>.*$`),
         },
     },
     "c": &langInfoT{
-        []*regexp.Regexp{
+        rxs: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*include\s*"(.+)".*$`),
+        },
+        sys: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*include\s*<(.+)>.*$`),
+        },
+    },
+    "c++": &langInfoT{
+        rxs: []*regexp.Regexp{
             regexp.MustCompile(`^\s*#\s*include\s*"(.+)".*$`),
+            regexp.MustCompile(`^\s*(?:export\s+)?import\s+"(.+)"\s*;`), // header unit
+            regexp.MustCompile(`^\s*(?:export\s+)?import\s+([\w.]+)\s*;`), // module
         },
-        []*regexp.Regexp{
+        sys: []*regexp.Regexp{
             regexp.MustCompile(`^\s*#\s*include\s*<(.+)>.*$`),
+            regexp.MustCompile(`^\s*(?:export\s+)?import\s+<(.+)>\s*;`),
+        },
+        suffixes: []string{ ".cppm", ".ixx", ".mpp", ".c++m" },
+    },
+    "objc": &langInfoT{
+        rxs: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*(?:include|import)\s*"(.+)".*$`),
+        },
+        sys: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*(?:include|import)\s*<(.+)>.*$`),
+            regexp.MustCompile(`^\s*@import\s+([\w.]+)\s*;`),
         },
     },
     "i": &langInfoT{
-        []*regexp.Regexp{
+        rxs: []*regexp.Regexp{
             regexp.MustCompile(`^\s*include\s*"(.+)".*$`),
         },
-        []*regexp.Regexp{
+    },
+    "fortran": &langInfoT{
+        rxs: []*regexp.Regexp{
+            regexp.MustCompile(`(?i)^\s*include\s*['"](.+)['"]`),
+            regexp.MustCompile(`^\s*#\s*include\s*"(.+)".*$`),
+        },
+        sys: []*regexp.Regexp{
+            // intrinsic or prebuilt modules are not required to exist
+            regexp.MustCompile(`(?i)^\s*use\s*(?:,\s*\w+\s*)?(?:::)?\s*(\w+)`),
         },
+        suffixes: []string{ ".mod", ".f90", ".F90", ".f", ".F" },
+    },
+    "proto": &langInfoT{
+        rxs: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*import\s+(?:public\s+|weak\s+)?"(.+)"\s*;`),
+        },
+    },
+    "glsl": &langInfoT{ // GL_GOOGLE_include_directive, also HLSL
+        rxs: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*include\s*"(.+)".*$`),
+        },
+        sys: []*regexp.Regexp{
+            regexp.MustCompile(`^\s*#\s*include\s*<(.+)>.*$`),
+        },
+    },
+    "go": &langInfoT{
+        sys: []*regexp.Regexp{ // packages are resolved by go itself
+            regexp.MustCompile(`^import\s+(?:[\w.]+\s+)?"([^"]+)"`),
+        },
+        blocks: []*langblock{{
+            begin: regexp.MustCompile(`^import\s*\(\s*(?://.*)?$`),
+            end: regexp.MustCompile(`^\s*\)`),
+            sys: []*regexp.Regexp{
+                regexp.MustCompile(`^\s*(?:[\w.]+\s+)?"([^"]+)"\s*(?://.*)?$`),
+            },
+        }},
+    },
+    "python": &langInfoT{
+        rxs: []*regexp.Regexp{ // relative imports only, 'from . import x' is '.x'
+            regexp.MustCompile(`^\s*from\s+(?:(\.+\w[\w.]*)\s+import\s|(\.+)\s*import\s+\(?\s*(\w+))`),
+        },
+        suffixes: []string{ ".py", "/__init__.py" },
+        dotted: true,
     },
 }
 
+// userlangs are the $(langinfo) languages of a universe, they take
+// precedence over the builtin langInfos.
+type userlangs struct {
+    sync.RWMutex
+    m map[string]*langInfoT
+}
+
+func (ls *userlangs) add(name string, info *langInfoT) {
+    ls.Lock(); defer ls.Unlock()
+    if ls.m == nil { ls.m = make(map[string]*langInfoT) }
+    ls.m[name] = info
+}
+
+func (ls *userlangs) get(name string) *langInfoT {
+    ls.RLock(); defer ls.RUnlock()
+    return ls.m[name]
+}
+
+// langInfo finds a language registered by $(langinfo) or a builtin one.
+func langInfo(ctx Context, name string) *langInfoT {
+    if u := _universe(ctx); u != nil {
+        if info := u.langs.get(name); info != nil { return info }
+    }
+    return langInfos[name]
+}
+
+// resolve maps a grepped name to the file name to search for.
+func (l *langInfoT) resolve(ctx Context, gc *grep_ctx, name string) string {
+    if l.dotted {
+        var n = len(name) - len(strings.TrimLeft(name, "."))
+        var s = strings.ReplaceAll(name[n:], ".", "/")
+        switch {
+        case n == 1: s = "./" + s
+        case n > 1: s = strings.Repeat("../", n-1) + s
+        }
+        name = s
+    }
+
+    var names = []string{ name }
+    for _, s := range l.suffixes {
+        if !strings.HasSuffix(name, s) { names = append(names, name + s) }
+    }
+
+    if len(names) == 1 && len(l.dirs) == 0 {
+        return name // as it is, e.g. C
+    }
+
+    var dirs = []string{ gc.dir.String() }
+    var sysroot = _universe(ctx).toolchainVar(ctx, "SYSROOT")
+    for _, s := range l.dirs {
+        if !filepath.IsAbs(s) {
+            s = filepath.Join(_project(ctx).absPath.String(), s)
+        } else if sysroot != "" {
+            s = filepath.Join(sysroot, s) // system dirs of the toolchain
+        }
+        dirs = append(dirs, s)
+    }
+
+    for _, s := range names {
+        for i, dir := range dirs {
+            if f := _stat(ctx, filepath.Join(dir, s)); f == nil || !f.isRegular() {
+                continue
+            } else if i == 0 {
+                return s
+            } else {
+                return filepath.Join(dir, s)
+            }
+        }
+    }
+    if l.dotted && len(names) > 1 {
+        return names[1] // module names are never file names
+    }
+    return name
+}
+
 // Allocate a 64KB initial buffer, but allow it to grow up to 10MB per line!
 const maxCapacity = 10 * 1024 * 1024
 
 var grepcacheM sync.Mutex // protect BOTH load and save
-var grepcache = make(map[Symbol][]Value)
+var grepcache = make(map[Symbol][]grepentry) // an entry for each options
+var grepcacheOnce sync.Once // load on the first (grep)
+
+// grepentry is the grepped files of a target with the options (see
+// grep_ctx.cachekey), valid unless the target is newer than mtime or a
+// search dir is newer than grepped.
+type grepentry struct {
+	opts    string
+	mtime   int64
+	grepped int64
+	files   []Value
+}
+
+// grepcacheGet and grepcachePut need grepcacheM locked.
+func grepcacheGet(k Symbol, opts string) (grepentry, bool) {
+	for _, e := range grepcache[k] {
+		if e.opts == opts { return e, true }
+	}
+	return grepentry{}, false
+}
+
+func grepcachePut(k Symbol, e grepentry) {
+	var list = grepcache[k]
+	for i := range list {
+		if list[i].opts != e.opts { continue }
+		if len(e.files) > 0 { list[i] = e } else {
+			list = append(list[:i], list[i+1:]...)
+		}
+		if len(list) == 0 { delete(grepcache, k) } else { grepcache[k] = list }
+		return
+	}
+	if len(e.files) > 0 { grepcache[k] = append(list, e) }
+}
+
+// grepcachefile tracks the binary grep cache file: the header (magic and
+// version) is followed by records of uvarint length, payload and CRC-64 of
+// the payload. A later record of a key and options replaces the earlier
+// ones. Changed keys are appended on save, the file is compacted (written
+// aside and renamed) when dead records outnumber live ones or the file is
+// broken.
+var grepcachefile struct {
+	loaded  bool
+	dirty   map[Symbol]bool // keys changed since load
+	records int             // records in the file
+	size    int64           // size of the valid part of the file
+	broken  bool            // bad header, checksum or torn tail
+}
+
+const (
+	grepCacheMagic   = "SMGC"
+	grepCacheVersion = 2
+)
+
+type grepcacherecord struct {
+	key     string
+	opts    string
+	mtime   int64
+	grepped int64
+	files   [][3]string // name, sub, dir
+}
+
+func grepCachePath(ctx Context) string {
+	return joinTmpPath(ctx, symEmpty, symCache).String()
+}
+
+func (r *grepcacherecord) encode(b []byte) []byte {
+	var p []byte
+	var str = func(s string) { p = enc_bin.AppendUvarint(p, uint64(len(s))); p = append(p, s...) }
+	str(r.key)
+	str(r.opts)
+	p = enc_bin.AppendVarint(p, r.mtime)
+	p = enc_bin.AppendVarint(p, r.grepped)
+	p = enc_bin.AppendUvarint(p, uint64(len(r.files)))
+	for _, f := range r.files { str(f[0]); str(f[1]); str(f[2]) }
+
+	b = enc_bin.AppendUvarint(b, uint64(len(p)))
+	b = append(b, p...)
+	return enc_bin.LittleEndian.AppendUint64(b, crc64.Checksum(p, crc64Table))
+}
+
+func (r *grepcacherecord) decode(p []byte) bool {
+	var str = func() (s string, ok bool) {
+		n, k := enc_bin.Uvarint(p)
+		if k <= 0 || uint64(len(p)-k) < n { return }
+		s, p = string(p[k:k+int(n)]), p[k+int(n):]
+		return s, true
+	}
+	var ok bool
+	if r.key, ok = str(); !ok { return false }
+	if r.opts, ok = str(); !ok { return false }
+	var k int
+	if r.mtime, k = enc_bin.Varint(p); k <= 0 { return false }
+	p = p[k:]
+	if r.grepped, k = enc_bin.Varint(p); k <= 0 { return false }
+	p = p[k:]
+	n, k := enc_bin.Uvarint(p)
+	if k <= 0 || n > uint64(len(p)) { return false }
+	p = p[k:]
+	r.files = make([][3]string, n)
+	for i := range r.files {
+		for j := 0; j < 3; j += 1 {
+			if r.files[i][j], ok = str(); !ok { return false }
+		}
+	}
+	return len(p) == 0
+}
+
+// readGrepCache calls f for each good record of the data and returns the
+// number of records and the size of the valid part, ok is false if the
+// data is not a grep cache of this version or has a broken tail.
+func readGrepCache(data []byte, f func(r *grepcacherecord)) (records int, size int64, ok bool) {
+	var head = len(grepCacheMagic) + 2
+	if len(data) < head || string(data[:len(grepCacheMagic)]) != grepCacheMagic ||
+		enc_bin.LittleEndian.Uint16(data[len(grepCacheMagic):]) != grepCacheVersion {
+		return
+	}
+	for p := data[head:]; ; records += 1 {
+		size = int64(len(data) - len(p))
+		if len(p) == 0 { return records, size, true }
+		n, k := enc_bin.Uvarint(p)
+		if k <= 0 || uint64(len(p)-k) < n+8 { return }
+		var r grepcacherecord
+		var payload = p[k:k+int(n)]
+		if enc_bin.LittleEndian.Uint64(p[k+int(n):]) != crc64.Checksum(payload, crc64Table) || !r.decode(payload) {
+			return
+		}
+		if f != nil { f(&r) }
+		p = p[k+int(n)+8:]
+	}
+}
 
 func loadGrepCache(ctx Context) {
 	// 1. Thread Safety: Lock during load in case of dynamic execution
 	grepcacheM.Lock()
 	defer grepcacheM.Unlock()
 
-	f, err := os.Open(joinTmpPath(ctx, symEmpty, symCache).String())
+	grepcachefile.loaded = true
+	data, err := os.ReadFile(grepCachePath(ctx))
 	if err != nil { return }
-	defer f.Close()
-
-	var (
-		list []Value
-		k    Symbol // 2. Upgraded to Symbol natively
-	)
 
-	buf := make([]byte, 0, 64*1024)
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(buf, maxCapacity)
-	scanner.Split(bufio.ScanLines)
-
-	for scanner.Scan() {
-		s := scanner.Text()
-		if strings.HasPrefix(s, ":") {
-			if k != symEmpty && len(list) > 0 {
-				// 3. CRITICAL FIX: Allocate a fresh slice to protect map memory!
-				stored := make([]Value, len(list))
-				copy(stored, list)
-				grepcache[k] = stored
-			}
-			list = list[:0]
-			k = intern(s[1:])
-		} else {
-			a := strings.Split(s, "|")
-			if len(a) == 3 {
-				// 4. Native Walled Garden reentry
-				_f := _stat(ctx, intern(a[0]), stat_sub{intern(a[1])}, stat_dir{intern(a[2])})
-				if _f != nil { list = append(list, _f) }
+	var ok bool
+	grepcachefile.records, grepcachefile.size, ok = readGrepCache(data, func(r *grepcacherecord) {
+		var list = make([]Value, 0, len(r.files))
+		for _, a := range r.files {
+			// Native Walled Garden reentry
+			if f := _stat(ctx, intern(a[0]), stat_sub{intern(a[1])}, stat_dir{intern(a[2])}); f != nil {
+				list = append(list, f)
 			}
 		}
-	}
-
-	// 5. CRITICAL FIX: Flush the final block at EOF!
-	if k != symEmpty && len(list) > 0 {
-		stored := make([]Value, len(list))
-		copy(stored, list)
-		grepcache[k] = stored
+		grepcachePut(intern(r.key), grepentry{r.opts, r.mtime, r.grepped, list})
+	})
+	if !ok {
+		grepcachefile.broken = true
+		debug(ctx, "%s: bad grep cache after %d records", grepCachePath(ctx), grepcachefile.records)
 	}
 }
 
 func saveGrepCache(ctx Context) {
-	s := joinTmpPath(ctx, symEmpty, symCache).String()
+	grepcacheM.Lock()
+	defer grepcacheM.Unlock()
 
-	// 1. Added os.O_TRUNC to wipe old garbage bytes!
-	// Changed to O_WRONLY as reading is not needed here.
-	f, err := os.OpenFile(s, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil { return }
-	defer f.Close()
+	if !grepcachefile.loaded || len(grepcachefile.dirty) == 0 && !grepcachefile.broken {
+		return
+	}
 
-	var w = bufio.NewWriter(f)
-	defer w.Flush()
+	var record = func(b []byte, k Symbol, e grepentry) []byte {
+		var r = grepcacherecord{ key: k.String(), opts: e.opts, mtime: e.mtime, grepped: e.grepped }
+		for _, v := range e.files {
+			if file, ok := to_file(v); ok {
+				// Explicit Walled Garden extraction
+				r.files = append(r.files, [3]string{__symbol(ctx, file).String(), file.sub.String(), file.dir.String()})
+			}
+		}
+		return r.encode(b)
+	}
 
-	grepcacheM.Lock()
-	defer grepcacheM.Unlock()
+	var s = grepCachePath(ctx)
+	var live, n int
+	for _, list := range grepcache { live += len(list) }
+	var dead = grepcachefile.records - live
+	if fi, err := os.Stat(s); err == nil && fi.Size() == grepcachefile.size &&
+		!grepcachefile.broken && dead <= live {
+		// Append the changed keys only.
+		var b []byte
+		for k := range grepcachefile.dirty {
+			for _, e := range grepcache[k] { b = record(b, k, e); n += 1 }
+		}
+		if f, err := os.OpenFile(s, os.O_WRONLY|os.O_APPEND, 0666); err != nil {
+			erro(ctx, "grep cache: %v", err)
+		} else if _, err = f.Write(b); err != nil {
+			f.Close()
+			erro(ctx, "grep cache: %v", err)
+		} else if err = f.Close(); err != nil {
+			erro(ctx, "grep cache: %v", err)
+		} else {
+			grepcachefile.records += n
+			grepcachefile.size += int64(len(b))
+			grepcachefile.dirty = nil
+		}
+		return
+	}
 
-	for k, l := range grepcache {
-		if len(l) == 0 { continue }
+	// Compaction: atomically replace the file with the live entries.
+	var b = append([]byte(grepCacheMagic), 0, 0)
+	enc_bin.LittleEndian.PutUint16(b[len(grepCacheMagic):], grepCacheVersion)
+	for k, list := range grepcache {
+		for _, e := range list { b = record(b, k, e) }
+	}
+	if err := os.MkdirAll(filepath.Dir(s), os.FileMode(0755)); err != nil {
+		erro(ctx, "grep cache: %v", err)
+	} else if err = os.WriteFile(s+".tmp", b, 0666); err != nil {
+		erro(ctx, "grep cache: %v", err)
+	} else if err = os.Rename(s+".tmp", s); err != nil {
+		erro(ctx, "grep cache: %v", err)
+	} else {
+		grepcachefile.records, _, _ = readGrepCache(b, nil)
+		grepcachefile.size = int64(len(b))
+		grepcachefile.broken = false
+		grepcachefile.dirty = nil
+	}
+}
 
-		// 2. Explicit .String() prevents reflection overhead
-		fmt.Fprintf(w, ":%s\n", k.String())
-		for _, v := range l {
-			var file, ok = to_file(v)
-			if !ok { continue }
+// grepCacheInfo serves -grep-cache-stats and -grep-cache-dump(TARGET ...),
+// it reads the cache file as it is, without checking the files.
+func (u *universe) grepCacheInfo(ctx Context) {
+	var s = grepCachePath(ctx)
+	data, err := os.ReadFile(s)
+	if err != nil {
+		erro(ctx, "grep cache: %v", err)
+		return
+	}
 
-			// 3. Replaced implicit %s formatting with explicit Walled Garden extraction
-			fmt.Fprintf(w, "%s|%s|%s\n",
-				__symbol(ctx, file).String(),
-				file.sub.String(),
-				file.dir.String())
+	var targets []string
+	for _, v := range merge(u.grepCacheDump...) {
+		if _, y := v.(*boolean); !y { targets = append(targets, __string(ctx, v)) }
+	}
+	var match = func(key string) bool {
+		if len(targets) == 0 { return true }
+		for _, t := range targets {
+			if key == t || strings.HasSuffix(key, string(filepath.Separator)+t) { return true }
+		}
+		return false
+	}
+
+	var live = make(map[string]*grepcacherecord)
+	var order []string
+	var files int
+	records, size, ok := readGrepCache(data, func(r *grepcacherecord) {
+		var k = r.key + "\x00" + r.opts
+		if _, y := live[k]; !y { order = append(order, k) }
+		live[k] = r
+	})
+	for _, r := range live { files += len(r.files) }
+
+	if u.grepCacheStats {
+		var state = "ok"
+		if !ok { state = fmt.Sprintf("broken at byte %d", size) }
+		prompt(ctx, "%s: version %d, %d bytes, %d records (%d live, %d dead), %d files, %s\n",
+			s, grepCacheVersion, len(data), records, len(live), records - len(live), files, state)
+	}
+	if u.grepCacheDump == nil { return }
+	for _, k := range order {
+		var r = live[k]
+		if !match(r.key) { continue }
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s (%d files, %v)\n", r.key, len(r.files), time_pkg.Unix(0, r.mtime).Format(time_pkg.RFC3339))
+		if r.opts != "" { fmt.Fprintf(&b, "  %s\n", r.opts) }
+		for _, f := range r.files {
+			if filepath.IsAbs(f[0]) {
+				fmt.Fprintf(&b, "    %s\n", f[0])
+			} else {
+				fmt.Fprintf(&b, "    %s\n", filepath.Join(f[2], f[1], f[0]))
+			}
 		}
+		prompt(ctx, "%s", b.String())
 	}
 }
 
@@ -35661,6 +39243,13 @@ func searchGreppedName(ctx Context, gp Position, gc *grep_ctx, sys bool, name Sy
 			_f("exists=%v, sys=%v, from %v", res.exists(), sys, _project(ctx)),
 			callstack{num: gc.debug}, unwind{})
 	}
+	if sys && (res == nil || !res.exists()) {
+		// system includes of the toolchain profile (see -toolchain)
+		if s := _universe(ctx).toolchainVar(ctx, "SYSROOT"); s != "" {
+			dir := intern(filepath.Join(s, "usr", "include"))
+			if f := _stat(ctx, name, stat_dir{dir}); f != nil && f.exists() { return f }
+		}
+	}
 	if sys || (res != nil && res.exists()) { return }
 
 	// relative to target directory
@@ -35876,34 +39465,113 @@ func grepTargetFile(ctx Context, gc *grep_ctx) (err error) {
     scanner := bufio.NewScanner(f)
     scanner.Buffer(buf, maxCapacity)
     scanner.Split(bufio.ScanLines)
-ForScan:
+
+    var block *langblock // see grepline
     for scanner.Scan() {
         var s = scanner.Text(); gp.Line += 1
-        for _, x := range gc.rxs {
-            if sm := x.FindStringSubmatch(s); len(sm) > 1 && sm[1] != "" {
-                var (
-					name = sm[1]
-					sys = x.bool
-				)
-                if gp.Column = strings.Index(s, name); gc.save != nil {
-                    var d = 0 ; if sys { d = 1 } // system files
-                    fmt.Fprintf(gc.save, "%d %d %d %s\n", d, gp.Line, gp.Column, name)
-                }
+        var x, name, column = gc.grepline(s, &block)
+        if x == nil { continue }
 
-				var f *file
-                if f, err = searchGrepped(ctx, gp, gc, sys, intern(name)); err != nil {
-                    erro(ctx, "search grepped '%s' failed: %v", name, err)
-                } else if f != nil {
-                    if /* f.pos = gp */; gc.isTargetFile(ctx, f) { continue }
-                } else if !sys && !gc.discard {
-                    debug(ctx,
-						_f("%s is nil file", name),
-						_f("grepped %s is nil", name),
-						_f("from project %v", _project(ctx)))
-                }
-                continue ForScan // found one
+        var sys = x.bool
+        if gp.Column = column; x.lang != nil {
+            name = x.lang.resolve(ctx, gc, name)
+        }
+        if gc.save != nil {
+            var d = 0 ; if sys { d = 1 } // system files
+            fmt.Fprintf(gc.save, "%d %d %d %s\n", d, gp.Line, gp.Column, name)
+        }
+
+        var f *file
+        if f, err = searchGrepped(ctx, gp, gc, sys, intern(name)); err != nil {
+            erro(ctx, "search grepped '%s' failed: %v", name, err)
+        } else if f == nil && !sys && !gc.discard {
+            debug(ctx,
+				_f("%s is nil file", name),
+				_f("grepped %s is nil", name),
+				_f("from project %v", _project(ctx)))
+        }
+    }
+    return
+}
+
+// cachekey sets the options and the search dirs of the grep cache entries,
+// a changed option or a file added to a search dir makes them stale.
+func (gc *grep_ctx) cachekey(ctx Context) {
+    var b strings.Builder
+    var sysroot = _universe(ctx).toolchainVar(ctx, "SYSROOT")
+    for _, s := range gc.langs {
+        fmt.Fprintf(&b, " -lang=%s", s)
+        if info := _universe(ctx).langs.get(s); info != nil { // user regexes
+            for _, rx := range info.rxs { fmt.Fprintf(&b, "(rx=%q)", rx) }
+            for _, rx := range info.sys { fmt.Fprintf(&b, "(sys=%q)", rx) }
+        }
+    }
+    for _, s := range gc.sys { fmt.Fprintf(&b, " -sys=%q", s) }
+    for _, s := range gc.reg { fmt.Fprintf(&b, " -rx=%q", s) }
+    for _, v := range gc.incs {
+        var s = __symbol(ctx, v)
+        gc.dirs = append(gc.dirs, s)
+        fmt.Fprintf(&b, " -i=%s", s)
+    }
+    for _, s := range gc.langs {
+        var info = langInfo(ctx, s)
+        if info == nil { continue }
+        for _, s := range info.dirs {
+            if !filepath.IsAbs(s) {
+                s = filepath.Join(_project(ctx).absPath.String(), s)
+            } else if sysroot != "" {
+                s = filepath.Join(sysroot, s)
             }
+            gc.dirs = append(gc.dirs, intern(s))
+        }
+    }
+    if sysroot != "" {
+        gc.dirs = append(gc.dirs, intern(filepath.Join(sysroot, "usr", "include")))
+        fmt.Fprintf(&b, " SYSROOT=%s", sysroot)
+    }
+    gc.opts = strings.TrimSpace(b.String())
+}
+
+// dirsMtime returns the newest mtime of the target's dir and the search dirs.
+func (gc *grep_ctx) dirsMtime(ctx Context) (mtime int64) {
+    for _, dir := range append([]Symbol{gc.dir}, gc.dirs...) {
+        if f := _stat(ctx, dir); f != nil && f.isDir() && f._mtime > mtime { mtime = f._mtime }
+    }
+    return
+}
+
+func (gc *grep_ctx) addLang(info *langInfoT) {
+    for _, re := range info.rxs { gc.rxs = append(gc.rxs, &grep_rx{false, re, info, nil}) }
+    for _, re := range info.sys { gc.rxs = append(gc.rxs, &grep_rx{true , re, info, nil}) }
+    for _, b := range info.blocks {
+        for _, re := range b.sys { gc.rxs = append(gc.rxs, &grep_rx{true , re, info, b}) }
+    }
+}
+
+// grepline returns the regex and the name grepped from the line s, block
+// is the langblock which the line is in (updated by begin and end lines).
+func (gc *grep_ctx) grepline(s string, block **langblock) (_ *grep_rx, name string, column int) {
+    if *block != nil && (*block).end.MatchString(s) {
+        *block = nil
+        return
+    }
+    for _, x := range gc.rxs {
+        if x.block == *block {
+        } else if *block == nil && x.block.begin.MatchString(s) {
+            *block = x.block
+            return
+        } else {
+            continue
         }
+
+        var sm = x.FindStringSubmatchIndex(s)
+        for i := 2; i+1 < len(sm); i += 2 {
+            if x.lang == nil && i > 2 { break } // the first capture only
+            if sm[i] < 0 || sm[i] == sm[i+1] { continue }
+            if name == "" { column = sm[i] }
+            name += s[sm[i]:sm[i+1]]
+        }
+        if name != "" { return x, name, column }
     }
     return
 }
@@ -35957,12 +39625,14 @@ func (g *grep_touch) work(ctx Context, gc *grep_ctx) (err error) {
 	return
 }
 
-type grep_rx struct{ bool ; *regexp.Regexp }
+type grep_rx struct{ bool ; *regexp.Regexp ; lang *langInfoT ; block *langblock }
 type grep_ctx struct {
     *modifier_grep
     grep_touch
     report bool // discard or report missing greps
     rxs []*grep_rx
+    opts string // see cachekey
+    dirs []Symbol // search dirs
     done map[Symbol]int
     savedGrepFileName Symbol
     savedGrepFile *file
@@ -36029,12 +39699,17 @@ func grep(ctx Context, gc *grep_ctx) (err error) {
 
 	if false { defer un(tt(l_traverse, _execution(ctx), gc.target)) }
 
+	grepcacheOnce.Do(func() { loadGrepCache(ctx) })
+
+	var cached bool
 	defer func(restore []Value) {
 		var t = _execution(ctx)
 		var touch = gc.grep_touch // copy grep_touch value
-		if len(touch.files) > 0 {
+		if len(touch.files) > 0 && !cached {
 			grepcacheM.Lock()
-			grepcache[gc.fullname] = touch.files
+			grepcachePut(gc.fullname, grepentry{gc.opts, touch.mtime, _universe(ctx).launchTime.UnixNano(), touch.files})
+			if grepcachefile.dirty == nil { grepcachefile.dirty = make(map[Symbol]bool) }
+			grepcachefile.dirty[gc.fullname] = true
 			grepcacheM.Unlock()
 		}
 		gc.files = restore
@@ -36060,13 +39735,15 @@ func grep(ctx Context, gc *grep_ctx) (err error) {
 	gc.files = nil
 
 	var (
-		cached bool
 		savedGrepFile *os.File
 		savedGrepFileLoaded bool
 	)
 	{
+		var dirs = gc.dirsMtime(ctx)
 		grepcacheM.Lock()
-		gc.files, cached = grepcache[gc.fullname]
+		if e, y := grepcacheGet(gc.fullname, gc.opts); y && e.mtime >= gc.mtime && e.grepped >= dirs {
+			gc.files, cached = e.files, true
+		}
 		grepcacheM.Unlock()
 	}
 	if cached && len(gc.files) > 0 {
@@ -36123,6 +39800,7 @@ func grep(ctx Context, gc *grep_ctx) (err error) {
 // grep - grep files from target, example usage:
 //
 //      (grep -file -x='\s*#\s*include\s*<(.*)>')
+//      (grep -lang=python)    // see langInfos and $(langinfo)
 //
 // https://github.com/google/re2/wiki/Syntax
 type modifier_grep struct { modifier_
@@ -36144,12 +39822,11 @@ func (ctx *modifier_grep) x(args ...Value) (result any) {
 	gc.incs = xmerge(ctx, ctx.incs...)
 
     // gc.fileinc = true // grep files by default
-    for _, s := range gc.sys { gc.rxs = append(gc.rxs, &grep_rx{true , regexp.MustCompile(s)}) }
-    for _, s := range gc.reg { gc.rxs = append(gc.rxs, &grep_rx{false, regexp.MustCompile(s)}) }
+    for _, s := range gc.sys { gc.rxs = append(gc.rxs, &grep_rx{true , regexp.MustCompile(s), nil, nil}) }
+    for _, s := range gc.reg { gc.rxs = append(gc.rxs, &grep_rx{false, regexp.MustCompile(s), nil, nil}) }
     for _, s := range gc.langs {
-        if info, ok := langInfos[s]; ok && info != nil {
-            for _, re := range info.rxs { gc.rxs = append(gc.rxs, &grep_rx{false, re}) }
-            for _, re := range info.sys { gc.rxs = append(gc.rxs, &grep_rx{true , re}) }
+        if info := langInfo(ctx, s); info != nil {
+            gc.addLang(info)
         } else {
             erro(ctx, "lang '%s' is unknown", s)
         }
@@ -36157,6 +39834,7 @@ func (ctx *modifier_grep) x(args ...Value) (result any) {
     if len(gc.rxs) == 0 {
         erro(ctx, "no grep expressions: %v %v %v %v", gc.sys, gc.reg, gc.langs, args)
     }
+    gc.cachekey(ctx)
 
     var (
         target = auto_get(ctx, symAt)
@@ -36264,7 +39942,7 @@ func parseDeps(ctx Context, targetVal Value, targetStr Symbol, savedDepsFile *fi
 	)
 
 	var depFile = func(ctx Context, depPos Position, word string) {
-		var dc = dep_context{diagnostic{ Context: ctx }}
+		var dc = dep_context{diagnostic{ Context: ctx, ctl: _diagcontrol(ctx) }}
 
 		ctx = &dc
 
@@ -36273,12 +39951,12 @@ func parseDeps(ctx Context, targetVal Value, targetStr Symbol, savedDepsFile *fi
 		} else if file := findDepFile(word); file == nil {
 			prompt(ctx, "%v: unknown dep\n", file)
 			if savedDepsFile != nil {
-				warn(ctx, "unknown dep '%v' for '%v'", word, firstWord)
-				warn(ctx, "from here: %s", word)
+				warn(ctx, "unknown dep '%v' for '%v'", word, firstWord, warncat("deps"))
+				warn(ctx, "from here: %s", word, warncat("deps"))
 				if filepath.IsAbs(firstWord) {
 					var wp Position
 					wp.Filename, wp.Line = intern(firstWord), 1
-					warn(ctx, "in here: %v", word)
+					warn(ctx, "in here: %v", word, warncat("deps"))
 				}
 				debug(ctx, "for project %v", proj)
 			} else {
@@ -36356,7 +40034,7 @@ func parseDeps(ctx Context, targetVal Value, targetStr Symbol, savedDepsFile *fi
 			for s, _ := range missing { debug(ctx, `missing "%v"`, s) }
 			erro(ctx, `%v: "%v" %d deps missing in "%v"`, proj, targetVal, len(missing), savedDepsFileName)
 		} else {
-			for s, _ := range missing { warn(ctx, `missing "%v"`, s) }
+			for s, _ := range missing { warn(ctx, `missing "%v"`, s, warncat("deps")) }
 			debug(ctx, `%v: "%v" missing %d deps (%v in total)`, proj, targetVal, len(missing), len(files))
 			files = nil // To update savedDepsFileName
 		}
@@ -36463,6 +40141,8 @@ func (ctx *modifier_extractdeps) x(args ...Value) (result any) {
 		}(time_pkg.Now())
 	}
 
+	var ccArgs []string // the rest of the toolchain CC, e.g. `ccache gcc`
+
 CorrectCC:
 	switch ctx.cc {
 	case "cl"   : ctx.cc = "clang"; goto CorrectCC
@@ -36472,6 +40152,23 @@ CorrectCC:
 	case "":
 		if ctx.useGcc   { ctx.cc = "gcc" }
 		if ctx.useClang { ctx.cc = "clang" }
+		if ctx.cc == "" { // falls back to the toolchain profile
+			var s string
+			switch ctx.lang {
+			case "c++", "cxx", "cpp", "objc++": s = uni.toolchainVar(ctx, "CXX")
+			}
+			if s == "" { s = uni.toolchainVar(ctx, "CC") }
+			if f := strings.Fields(s); len(f) > 0 {
+				ctx.cc, ccArgs = f[0], f[1:]
+				for _, w := range f { // the compiler behind a wrapper
+					if base := filepath.Base(w); strings.Contains(base, "clang") {
+						ctx.useClang = true; break
+					} else if strings.Contains(base, "gcc") {
+						ctx.useGcc = true; break
+					}
+				}
+			}
+		}
 	default:
 		if base := filepath.Base(ctx.cc); base == "" {
 			erro(ctx, "unsupported cc: %v", ctx.cc)
@@ -36496,6 +40193,12 @@ CorrectCC:
 		default: ca = append(ca, s)
 		}
 	}
+	if s := uni.toolchainVar(ctx, "SYSROOT"); s != "" {
+		ca = append(ca, intern("--sysroot=" + s))
+	}
+	if s := uni.toolchainVar(ctx, "TARGET"); s != "" && ctx.useClang {
+		ca = append(ca, intern("--target=" + s))
+	}
 	if !_MM { ca = append(ca, symDashM)  } // both user and system headers
 	if !_MG && ctx.addMissing { ca = append(ca, symDashMG) } // add missing headers
 
@@ -36522,9 +40225,10 @@ CorrectCC:
 		// =========================================================
 		// THE OS AIRLOCK: Convert Symbol array to string array ONCE
 		// =========================================================
-		caStrs := make([]string, len(ca))
-		for i, s := range ca {
-			caStrs[i] = s.String()
+		caStrs := make([]string, 0, len(ccArgs)+len(ca))
+		caStrs = append(caStrs, ccArgs...)
+		for _, s := range ca {
+			caStrs = append(caStrs, s.String())
 		}
 
 		var (
@@ -37087,6 +40791,507 @@ func (ctx *modifier_copyfile) x(args ...Value) (result any) {
 	return
 }
 
+// (download https://example.com/foo-1.0.tar.gz)
+// (download -sha256=<hex> https://example.com/foo-1.0.tar.gz)
+// (download -sha256=<hex>,https://example.com/foo-1.0.tar.gz,filename)
+type modifier_download struct { modifier_
+	sha256 string "sha,sha256,checksum"
+	force bool "f,force"
+}
+func (ctx *modifier_download) x(args ...Value) (result any) {
+	var source, target Value
+	if len(args) > 0 {
+		source = args[0]
+	} else {
+		erro(ctx, "download: no url")
+		return
+	}
+	if len(args) > 1 {
+		target = args[1]
+	} else {
+		target = auto_get(ctx, symAt)
+	}
+
+	var u = parseFetchURL(ctx, source)
+	if u == nil { return }
+
+	var f, ok = unloc(target).(*file)
+	if !ok {
+		var project = _project(ctx)
+		if f = project.file(ctx, __string(ctx, target)); f == nil {
+			f = _stat(ctx, intern(__string(ctx, target)), stat_nonexist{true})
+		}
+	}
+	if f == nil {
+		erro(ctx, "download: '%v' is not a file", target)
+	} else if dryModifier(ctx, "download", "%v → %v", source, f.fullname()) {
+		result = f
+	} else if err := fetch(ctx, u, f, ctx.sha256, ctx.force, ctx.verbose); err != nil {
+		erro(ctx, "download: %v", err)
+	} else {
+		result = f
+	}
+	return
+}
+
+type archiveformat uint8
+
+const (
+	archiveUnknown archiveformat = iota
+	archiveTar
+	archiveTarGz
+	archiveTarBz2
+	archiveZip
+)
+
+// archiveFormat determines the format from the -format option or the
+// suffix of the archive file name.
+func archiveFormat(name, format string) archiveformat {
+	if format == "" { format = strings.ToLower(name) }
+	switch {
+	case format == "tar",     strings.HasSuffix(format, ".tar"): return archiveTar
+	case format == "tar.gz",  format == "tgz", format == "gz",
+		strings.HasSuffix(format, ".tar.gz"), strings.HasSuffix(format, ".tgz"): return archiveTarGz
+	case format == "tar.bz2", format == "tbz2", format == "bz2",
+		strings.HasSuffix(format, ".tar.bz2"), strings.HasSuffix(format, ".tbz2"): return archiveTarBz2
+	case format == "zip",     strings.HasSuffix(format, ".zip"): return archiveZip
+	}
+	return archiveUnknown
+}
+
+// archive_filter selects archive entries by include/exclude patterns
+// (globs or percent patterns, e.g. `*.h`, `%.c`, `test/*`) and strips leading
+// path components from entry names.
+type archive_filter struct {
+	Context
+	strip int
+	include, exclude []Value
+}
+
+// matches tells if one of the patterns (globs or percent patterns, see
+// match) matches the entry name or one of its directories (e.g. test).
+func (f *archive_filter) matches(pats []Value, name string) bool {
+	for _, pat := range pats {
+		if m, _, rem, _ := match(f, pat, _rw(pat.Pos(), name)); !m {
+			continue
+		} else if rem == nil {
+			return true
+		} else if s := __string(f, rem); s == "" || strings.HasPrefix(s, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the filtered entry name, or false if the entry is skipped.
+func (f *archive_filter) name(name string) (string, bool) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+	if f.strip > 0 {
+		var parts = strings.Split(strings.Trim(name, "/"), "/")
+		if len(parts) <= f.strip { return "", false }
+		name = strings.Join(parts[f.strip:], "/")
+	}
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", false
+	}
+	if f.include != nil && !f.matches(f.include, name) { return "", false }
+	if f.exclude != nil &&  f.matches(f.exclude, name) { return "", false }
+	return name, true
+}
+
+// reproducibleTime returns the timestamp for archive entries, either the
+// -mtime option (seconds or RFC3339), the SOURCE_DATE_EPOCH environment,
+// or the DOS epoch which is valid for all supported formats.
+func reproducibleTime(ctx Context, mtime string) time_pkg.Time {
+	if mtime == "" { mtime = os.Getenv("SOURCE_DATE_EPOCH") }
+	if mtime != "" {
+		if n, e := strconv.ParseInt(mtime, 10, 64); e == nil {
+			return time_pkg.Unix(n, 0).UTC()
+		} else if t, e := time_pkg.Parse(time_pkg.RFC3339, mtime); e == nil {
+			return t.UTC()
+		}
+		erro(ctx, "invalid mtime: %s", mtime)
+	}
+	return time_pkg.Date(1980, 1, 1, 0, 0, 0, 0, time_pkg.UTC)
+}
+
+type extracted struct {
+	dir   string
+	names []string
+	keep  bool // keep archive timestamps
+}
+
+// resolve returns the file name of an entry and the directory it lands in
+// relative to x.dir, after following the symlinks already on disk (which may
+// come from earlier entries of the same archive). Entries whose directory
+// resolves outside of x.dir are refused.
+func (x *extracted) resolve(name string) (filename, rel string, err error) {
+	filename = filepath.Join(x.dir, filepath.FromSlash(name))
+	var root, dir string
+	if root, err = evalExisting(x.dir); err != nil { return }
+	if dir, err = evalExisting(filepath.Dir(filename)); err != nil { return }
+	if rel, err = filepath.Rel(root, dir); err == nil && !filepath.IsLocal(rel) {
+		err = fmt.Errorf("%s: path escapes %s through a symlink", name, x.dir)
+	}
+	return
+}
+
+// evalExisting resolves symlinks in the longest existing prefix of name.
+func evalExisting(name string) (string, error) {
+	var rest string
+	for {
+		if s, err := filepath.EvalSymlinks(name); err == nil {
+			return filepath.Join(s, rest), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		var dir = filepath.Dir(name)
+		if dir == name { return filepath.Join(name, rest), nil }
+		rest, name = filepath.Join(filepath.Base(name), rest), dir
+	}
+}
+
+func (x *extracted) mkdir(name string) (err error) {
+	var filename string
+	if filename, _, err = x.resolve(name); err == nil {
+		err = os.MkdirAll(filename, os.FileMode(0755))
+	}
+	return
+}
+
+func (x *extracted) create(name string, mode os.FileMode, mtime time_pkg.Time, r io.Reader) (err error) {
+	var filename string
+	if filename, _, err = x.resolve(name); err != nil { return }
+	if err = os.MkdirAll(filepath.Dir(filename), os.FileMode(0755)); err != nil { return }
+	os.Remove(filename) // replace read-only or linked files
+
+	var f *os.File
+	if f, err = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0200); err != nil { return }
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err == nil && x.keep {
+		err = os.Chtimes(filename, mtime, mtime)
+	}
+	x.names = append(x.names, filename)
+	return
+}
+
+func (x *extracted) symlink(name, link string) (err error) {
+	var filename, rel string
+	if filename, rel, err = x.resolve(name); err != nil { return }
+	if filepath.IsAbs(link) || !filepath.IsLocal(filepath.Join(rel, link)) {
+		return fmt.Errorf("%s: unsafe symlink to %s", name, link)
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), os.FileMode(0755)); err != nil { return }
+	os.Remove(filename)
+	if err = os.Symlink(link, filename); err == nil {
+		x.names = append(x.names, filename)
+	}
+	return
+}
+
+func (x *extracted) untar(ctx *archive_filter, r io.Reader) (err error) {
+	var tr = tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return
+		}
+		var name, ok = ctx.name(hdr.Name)
+		if !ok { continue }
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(name)
+		case tar.TypeReg:
+			err = x.create(name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = x.symlink(name, hdr.Linkname)
+		case tar.TypeLink:
+			if link, ok := ctx.name(hdr.Linkname); ok {
+				var src, dst string
+				if src, _, err = x.resolve(link); err != nil { break }
+				if dst, _, err = x.resolve(name); err != nil { break }
+				os.Remove(dst)
+				if err = os.Link(src, dst); err == nil { x.names = append(x.names, dst) }
+			}
+		}
+		if err != nil { return }
+	}
+}
+
+func (x *extracted) unzip(ctx *archive_filter, filename string) (err error) {
+	var zr *zip.ReadCloser
+	if zr, err = zip.OpenReader(filename); err != nil { return }
+	defer zr.Close()
+	for _, zf := range zr.File {
+		var name, ok = ctx.name(zf.Name)
+		if !ok { continue }
+		if zf.FileInfo().IsDir() {
+			err = x.mkdir(name)
+		} else if zf.Mode()&os.ModeSymlink != 0 {
+			var rc io.ReadCloser
+			if rc, err = zf.Open(); err != nil { return }
+			var link []byte
+			if link, err = io.ReadAll(rc); err == nil {
+				err = x.symlink(name, string(link))
+			}
+			rc.Close()
+		} else {
+			var rc io.ReadCloser
+			if rc, err = zf.Open(); err != nil { return }
+			err = x.create(name, zf.Mode(), zf.Modified, rc)
+			rc.Close()
+		}
+		if err != nil { return }
+	}
+	return
+}
+
+// (extract)
+// (extract -strip=1 -include=%.h -exclude=test/*,foo.tar.gz,dir)
+//
+// Extracts the archive (default to $<) into the directory (default to the
+// project directory), and stamps all extracted files as updated targets.
+type modifier_extract struct { modifier_
+	strip int "s,strip,strip-components"
+	include []Value "i,include"
+	exclude []Value "x,exclude"
+	format string "format"
+	keep bool "k,keep-mtime"
+}
+func (ctx *modifier_extract) x(exe *execution, args ...Value) (result any) {
+	var source, dest Value
+	if len(args) > 0 { source = args[0] } else { source = auto_get(ctx, symLangle) }
+	if len(args) > 1 { dest = args[1] }
+
+	var _, sourceSym = file_stat(ctx, source)
+	if sourceSym == symEmpty {
+		erro(ctx, "extract: no archive (%v)", source)
+		return
+	}
+
+	var x = &extracted{ keep: ctx.keep }
+	if dest != nil {
+		x.dir = __string(ctx, dest)
+	}
+	if p := _project(ctx); !filepath.IsAbs(x.dir) && p != nil {
+		x.dir = filepath.Join(p.absPath.String(), x.dir)
+	}
+
+	var filter = &archive_filter{ctx, ctx.strip, ctx.include, ctx.exclude}
+	var filename = sourceSym.String()
+	var err error
+
+	if dryModifier(ctx, "extract", "%s → %s", filename, x.dir) { return }
+
+	if ctx.verbose { prompt(ctx, "extract %v …", source) }
+
+	switch archiveFormat(filename, ctx.format) {
+	case archiveZip:
+		err = x.unzip(filter, filename)
+	case archiveTar, archiveTarGz, archiveTarBz2:
+		var f *os.File
+		if f, err = os.Open(filename); err != nil { break }
+		defer f.Close()
+
+		var r io.Reader = f
+		switch archiveFormat(filename, ctx.format) {
+		case archiveTarGz:
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(f); err != nil { break }
+			defer zr.Close()
+			r = zr
+		case archiveTarBz2:
+			r = bzip2.NewReader(f)
+		}
+		if err == nil { err = x.untar(filter, r) }
+	default:
+		err = fmt.Errorf("%v: unknown archive format", source)
+	}
+
+	if err != nil {
+		erro(ctx, "extract: %v", err)
+	}
+
+	var files []Value
+	for _, name := range x.names {
+		if f := stamp_target(exe, _stat(ctx, intern(name), stat_nonexist{true})); f != nil {
+			files = append(files, f)
+		}
+	}
+
+	if ctx.verbose { prompt(ctx, "… %d files\n", len(files)) }
+	return files
+}
+
+// (archive)
+// (archive -format=tar.gz -prefix=foo-1.0 -exclude=%.o,src include)
+//
+// Creates the archive target (default to $@) from the sources (default to
+// $^). Entries are sorted, owned by root and timestamped by -mtime (or
+// SOURCE_DATE_EPOCH) so that archives are reproducible.
+type modifier_archive struct { modifier_
+	include []Value "i,include"
+	exclude []Value "x,exclude"
+	format string "format"
+	prefix string "prefix"
+	dir string "C,dir"
+	mtime string "mtime"
+}
+func (ctx *modifier_archive) x(exe *execution, args ...Value) (result any) {
+	var target = auto_get(ctx, symAt)
+	var sources = args
+	if len(sources) == 0 { sources = merge(auto_get(ctx, symCaret)) }
+
+	var _, targetSym = file_stat(ctx, target)
+	if targetSym == symEmpty {
+		erro(ctx, "archive: no target (%v)", target)
+		return
+	} else if dryModifier(ctx, "archive", "%v → %v", sources, targetSym) {
+		return
+	}
+
+	var base = ctx.dir
+	if p := _project(ctx); !filepath.IsAbs(base) && p != nil {
+		base = filepath.Join(p.absPath.String(), base)
+	}
+
+	var filter = &archive_filter{ctx, 0, ctx.include, ctx.exclude}
+	var entries = make(map[string]string) // name -> filename
+	for _, source := range sources {
+		var _, sym = file_stat(ctx, source)
+		if sym == symEmpty { sym = intern(__string(ctx, source)) }
+
+		var root = sym.String()
+		if !filepath.IsAbs(root) { root = filepath.Join(base, root) }
+
+		err := filepath.WalkDir(root, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() { return err }
+			if rel, e := filepath.Rel(base, filename); e != nil {
+				return e
+			} else if name, ok := filter.name(rel); ok {
+				if ctx.prefix != "" { name = filepath.ToSlash(filepath.Join(ctx.prefix, name)) }
+				entries[name] = filename
+			}
+			return nil
+		})
+		if err != nil {
+			erro(ctx, "archive: %v", err)
+			return
+		}
+	}
+
+	var names = make([]string, 0, len(entries))
+	for name := range entries { names = append(names, name) }
+	sort.Strings(names)
+
+	var filename = targetSym.String()
+	var mtime = reproducibleTime(ctx, ctx.mtime)
+
+	if ctx.verbose { prompt(ctx, "archive %v …", target) }
+
+	var err = os.MkdirAll(filepath.Dir(filename), os.FileMode(0755))
+	var part = filename + ".part"
+	var out *os.File
+	if err == nil { out, err = os.Create(part) }
+	if err != nil {
+		erro(ctx, "archive: %v", err)
+		return
+	}
+
+	switch archiveFormat(filename, ctx.format) {
+	case archiveZip:
+		err = writeZip(out, names, entries, mtime)
+	case archiveTar:
+		err = writeTar(out, names, entries, mtime)
+	case archiveTarGz:
+		var zw = gzip.NewWriter(out)
+		if err = writeTar(zw, names, entries, mtime); err == nil {
+			err = zw.Close()
+		}
+	case archiveTarBz2:
+		err = fmt.Errorf("%v: bzip2 compression is unsupported", target)
+	default:
+		err = fmt.Errorf("%v: unknown archive format", target)
+	}
+
+	if e := out.Close(); err == nil { err = e }
+	if err == nil { err = os.Rename(part, filename) }
+	if err != nil {
+		os.Remove(part)
+		erro(ctx, "archive: %v", err)
+		return
+	}
+
+	if ctx.verbose { prompt(ctx, "… %d files\n", len(names)) }
+	return stamp_target(exe, target)
+}
+
+func writeTar(w io.Writer, names []string, entries map[string]string, mtime time_pkg.Time) (err error) {
+	var tw = tar.NewWriter(w)
+	for _, name := range names {
+		var info os.FileInfo
+		if info, err = os.Lstat(entries[name]); err != nil { return }
+
+		var hdr = &tar.Header{
+			Name:    name,
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: mtime,
+			Format:  tar.FormatPAX,
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			hdr.Typeflag = tar.TypeSymlink
+			if hdr.Linkname, err = os.Readlink(entries[name]); err != nil { return }
+			err = tw.WriteHeader(hdr)
+		} else {
+			hdr.Typeflag, hdr.Size = tar.TypeReg, info.Size()
+			if err = tw.WriteHeader(hdr); err == nil {
+				err = copyFileTo(tw, entries[name])
+			}
+		}
+		if err != nil { return }
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, names []string, entries map[string]string, mtime time_pkg.Time) (err error) {
+	var zw = zip.NewWriter(w)
+	for _, name := range names {
+		var info os.FileInfo
+		if info, err = os.Lstat(entries[name]); err != nil { return }
+
+		var hdr = &zip.FileHeader{ Name: name, Method: zip.Deflate, Modified: mtime }
+		hdr.SetMode(info.Mode() & (os.ModeSymlink|os.ModePerm))
+
+		var fw io.Writer
+		if fw, err = zw.CreateHeader(hdr); err != nil { return }
+		if info.Mode()&os.ModeSymlink != 0 {
+			// symlinks are stored with the link as content, like Info-ZIP
+			var link string
+			if link, err = os.Readlink(entries[name]); err == nil {
+				_, err = io.WriteString(fw, link)
+			}
+		} else {
+			err = copyFileTo(fw, entries[name])
+		}
+		if err != nil { return }
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, filename string) (err error) {
+	var f *os.File
+	if f, err = os.Open(filename); err == nil {
+		_, err = io.Copy(w, f)
+		f.Close()
+	}
+	return
+}
+
 type modifier_writefile struct { modifier_ }
 func (ctx *modifier_writefile) x(exe *execution, args ...Value) (result any) {
 	args = xmerge(ctx, args...)
@@ -37104,6 +41309,8 @@ func (ctx *modifier_writefile) x(exe *execution, args ...Value) (result any) {
     if isTrivial(target) {
         erro(ctx, "%v: target is trivial (%v)", target, args)
 		return nil
+    } else if dryModifier(ctx, "write-file", "%v", target) {
+        return nil
     }
 
     var f *os.File
@@ -37449,7 +41656,7 @@ func (ctx *modifier_wait) x(args ...Value) (result any) {
         v Value
     )
     if ctx.stdout {
-        // TODO: warn(ctx, "deprecated (wait -stdout), use (shell -stdout) instead; %v", execRes).debug()
+        warn(ctx, "deprecated (wait -stdout), use (shell -stdout) instead", warncat("deprecated"))
         if b := execRes.stdout.Buf; b != nil { s = b.String() }
         if ctx.trim { s = strings.TrimSpace(s) }
         switch ctx.asType {
@@ -37460,7 +41667,7 @@ func (ctx *modifier_wait) x(args ...Value) (result any) {
         a = append(a, v)
     }
     if ctx.stderr {
-        // TODO: warn(ctx, "deprecated (wait -stderr), use (shell -stderr) instead; %v", execRes).debug()
+        warn(ctx, "deprecated (wait -stderr), use (shell -stderr) instead", warncat("deprecated"))
         if b := execRes.stderr.Buf; b != nil { s = b.String() }
         if ctx.trim { s = strings.TrimSpace(s) }
         switch ctx.asType {
@@ -37471,7 +41678,7 @@ func (ctx *modifier_wait) x(args ...Value) (result any) {
         a = append(a, v)
     }
     if ctx.status {
-        // TODO: warn(ctx, "deprecated (wait -status), use (shell -status) instead; %v", execRes).debug()
+        warn(ctx, "deprecated (wait -status), use (shell -status) instead", warncat("deprecated"))
         a = append(a, _decimal(pos,int64(execRes.status),0))
     }
 
@@ -37530,6 +41737,8 @@ func stamp_target(x *execution, target Value) *file {
 			x.session.updatedFiles[tFile] = []Value{}
 		}
 		x.session.Unlock()
+
+		stampFile(x, tFile) // see -clean
 	}
 	return tFile
 }
@@ -37596,7 +41805,7 @@ func (ctx *modifier_assert) z(args ...Value) (_ any) {
         b := v != nil && __true(ctx, v)
         f := u.hooks.assert
 
-        if (f != nil && f(ctx, v, b)) || b {
+        if (f != nil && f(pc(ctx,a), v, b)) || b {
             continue
         } else if ctx.msg == "" {
             var s string
@@ -37646,6 +41855,30 @@ func (ctx *modifier_dirty) x(exe *execution, args ...Value) (result any) {
     }
 }
 
+// (precious [FILE ...]) never removes the target (or the files) when
+// failed or interrupted, nor as an intermediate, nor by -clean.
+type modifier_precious struct { modifier_ }
+func (ctx *modifier_precious) x(exe *execution, args ...Value) (result any) {
+    markTargets(exe, args, markPrecious)
+    return
+}
+
+// (intermediate [FILE ...]) removes the target (or the files) after the
+// build if it's made by the build.
+type modifier_intermediate struct { modifier_ }
+func (ctx *modifier_intermediate) x(exe *execution, args ...Value) (result any) {
+    markTargets(exe, args, markIntermediate)
+    return
+}
+
+// (secondary [FILE ...]) keeps the target (or the files) even if it's an
+// intermediate.
+type modifier_secondary struct { modifier_ }
+func (ctx *modifier_secondary) x(exe *execution, args ...Value) (result any) {
+    markTargets(exe, args, markSecondary)
+    return
+}
+
 type modifier_fork struct { modifier_
     wd string `workdir,wd`
 }
@@ -37705,7 +41938,9 @@ func (ctx *modifier_fork) x(exe *execution, args ...Value) (result any) {
     var cmd = exec.Command(x, argv...)
 	cmd.Dir, cmd.Stdout, cmd.Stderr = wd, stdout, stderr
     cmd.Env, _ = exe.env(ctx)
+    jobserverCmd(exe, cmd)
 
+    defer jobToken(exe)()
     if err = cmd.Run(); err != nil {
         erro(ctx, "fork: %v: %v", x, err)
     } else {
@@ -37979,6 +42214,7 @@ var builtins = map[Symbol]builtinmeta{
 	symWarning:   makeBuiltin((*__warning)(nil)),
 	symAssert:    makeBuiltin((*__assert)(nil)),
 	symSure:      makeBuiltin((*__sure)(nil)),
+	symSkip:      makeBuiltin((*__skip)(nil)),
 	symTrace:     makeBuiltin((*__trace)(nil)),
 
 	symDefor:     makeBuiltin((*__defor)(nil)),
@@ -38138,6 +42374,9 @@ var builtins = map[Symbol]builtinmeta{
 	symTruncate:     makeBuiltin((*__truncate)(nil)),
 
 	symServeHttp:    makeBuiltin((*__servehttp)(nil)),
+	symFetch:        makeBuiltin((*__fetch)(nil)),
+	symMatcher:      makeBuiltin((*__matcher)(nil)),
+	symLanginfo:     makeBuiltin((*__langinfo)(nil)),
 }
 
 func escapedString(ctx Context, v Value) (s string) {
@@ -38267,7 +42506,7 @@ outer:
         var value Value
 
         // 1. Extract the flag identity safely FIRST
-        switch t := arg.(type) {
+        switch t := hoist_flag_args(arg).(type) {
         case        flag: f, y = t, true; value = _boolean(t.Pos(), true)
         case       *pair: if f, y = t.key.(flag);   y { value = t.val }
         case *argumented: if f, y = t.Value.(flag); y { value = ease(ctx, t.args) }
@@ -38647,14 +42886,39 @@ func (ctx *__sure) do(c Context, op any) any {
 	return ctx.builtinbase.do(c, op)
 }
 func (ctx *__sure) x() (res any) {
+    var hook = _universe(ctx).hooks.assert
     for _, a := range ctx.a {
-        if !__true(ctx, a) {
-            erro(ctx, "assert: %v", ts(a,ctx))
+        var c = pc(ctx, a)
+        var y = __true(c, a)
+        if hook != nil && hook(c, a, y) || y {
+            continue
         }
+        erro(ctx, "assert: %v", ts(a,ctx))
     }
     return ctx.a
 }
 
+// $(skip reason...) stops the current test rule and reports it skipped,
+// outside of `-test` it simply leaves the rule like (cond) does.
+type __skip struct { builtinbase }
+func (ctx *__skip) do(c Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return &ctx.builtinbase
+	case dynamic_cast: return t.ctx(ctx, &ctx.builtinbase)
+	}
+	return ctx.builtinbase.do(c, op)
+}
+func (ctx *__skip) x() (res any) {
+    var s []string
+    for _, a := range merge(ctx.a...) {
+        s = append(s, __string(ctx, a))
+    }
+    if tc, _ := do(ctx, is_test_case{}).(*testcase); tc != nil {
+        panic(test_skipped{_position(ctx), strings.Join(s, " ")})
+    }
+    panic(traverse_state{_pos(ctx), traverse_done})
+}
+
 type __trace struct { builtinbase }
 func (ctx *__trace) do(c Context, op any) any {
 	switch t := op.(type) {
@@ -39507,6 +43771,301 @@ func (ctx *__servehttp) x() (res any) {
     return
 }
 
+// fetchfile returns the cache file for the fetched url, the file is placed
+// in the `.fetch` sub-directory of the project temp dir and keeps the
+// basename of the url path, so that archive suffixes are preserved.
+func (p *project) fetchfile(ctx Context, u *neturl.URL, name string) *file {
+    if name == "" { name = filepath.Base(u.Path) }
+    switch name { case "", ".", "/": name = "index" }
+
+    path, err := hashPath(".fetch", u.String())
+    if err != nil {
+        erro(ctx, "hashing failed: %v", err)
+        return nil
+    }
+    return _stat(ctx, intern(filepath.Join(path, name)), stat_dir{p.tempdirSym(ctx)}, stat_nonexist{true})
+}
+
+// sha256File computes the hex encoded SHA-256 checksum of the named file.
+func sha256File(filename string) (string, error) {
+    f, err := os.Open(filename)
+    if err != nil { return "", err }
+    defer f.Close()
+
+    h := sha256Pool.Get().(hash_pkg.Hash)
+    h.Reset()
+    defer sha256Pool.Put(h)
+
+    if _, err = io.Copy(h, f); err != nil { return "", err }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetch retrieves the url (http, https or file) into the target file. The
+// target is reused if it exists and matches the checksum (if specified).
+// The content is written into a `.part` file first and then renamed, so an
+// interrupted fetch never leaves a broken target. A http fetch is stopped
+// after fetchTimeout, or when the embedded Run is canceled.
+func fetch(ctx Context, u *neturl.URL, target *file, checksum string, force, verbose bool) (err error) {
+    var filename = target.fullname().String()
+    checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+
+    if !force && target.stat(ctx, true) {
+        if checksum == "" { return }
+        if sum, e := sha256File(filename); e == nil && sum == checksum {
+            if verbose { prompt(ctx, "fetch %v …… cached\n", u) }
+            return
+        }
+    }
+
+    if verbose { prompt(ctx, "fetch %v …", u) }
+
+    var body io.ReadCloser
+    switch u.Scheme {
+    case "http", "https":
+        var c = context.Background()
+        if x := _universe(ctx); x != nil && x.runctx != nil { c = x.runctx }
+
+        var req *http.Request
+        var res *http.Response
+        if req, err = http.NewRequestWithContext(c, http.MethodGet, u.String(), nil); err != nil {
+            return
+        } else if res, err = fetchClient.Do(req); err != nil {
+            return
+        } else if res.StatusCode != http.StatusOK {
+            res.Body.Close()
+            return fmt.Errorf("%v: %s", u, res.Status)
+        }
+        body = res.Body
+    case "file":
+        var name = u.Path
+        if name == "" { name = u.Opaque }
+        if body, err = os.Open(filepath.FromSlash(name)); err != nil { return }
+    default:
+        return fmt.Errorf("%v: unsupported scheme '%s'", u, u.Scheme)
+    }
+    defer body.Close()
+
+    if err = os.MkdirAll(filepath.Dir(filename), os.FileMode(0755)); err != nil { return }
+
+    var part = filename + ".part"
+    var out *os.File
+    if out, err = os.Create(part); err != nil { return }
+
+    h := sha256Pool.Get().(hash_pkg.Hash)
+    h.Reset()
+    defer sha256Pool.Put(h)
+
+    var size int64
+    size, err = io.Copy(io.MultiWriter(out, h), body)
+    if e := out.Close(); err == nil { err = e }
+    if err != nil {
+        os.Remove(part)
+        return
+    }
+
+    if sum := hex.EncodeToString(h.Sum(nil)); checksum != "" && sum != checksum {
+        os.Remove(part)
+        return fmt.Errorf("%v: checksum mismatched (sha256 %s, expects %s)", u, sum, checksum)
+    } else if err = os.Rename(part, filename); err != nil {
+        return
+    }
+
+    target.stat(ctx, true)
+    if verbose { prompt(ctx, "… %d bytes\n", size) }
+    return
+}
+
+func parseFetchURL(ctx Context, v Value) (u *neturl.URL) {
+    if t, ok := unloc(v).(*url); ok {
+        u = t.Validate()
+    } else if t, e := neturl.Parse(__string(ctx, v)); e == nil {
+        u = t
+    }
+    if u == nil || u.Scheme == "" {
+        erro(ctx, "'%v' is not an url", v)
+        u = nil
+    }
+    return
+}
+
+// $(fetch https://example.com/foo-1.0.tar.gz)
+// $(fetch -sha256=<hex> -name=foo.tar.gz https://example.com/download?id=1)
+type __fetch struct { builtinbase
+    sha256 string `sha,sha256,checksum`
+    name   string `n,name`
+    force  bool   `f,force`
+}
+func (ctx *__fetch) do(c Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return &ctx.builtinbase
+	case dynamic_cast: return t.ctx(ctx, &ctx.builtinbase)
+	}
+	return ctx.builtinbase.do(c, op)
+}
+func (ctx *__fetch) x() (res any) {
+    var vals []Value
+    var proj = _project(ctx)
+    for _, a := range merge(ctx.a...) {
+        if u := parseFetchURL(ctx, a); u == nil {
+            continue
+        } else if f := proj.fetchfile(ctx, u, ctx.name); f == nil {
+            erro(ctx, "%v: no fetch file", u)
+        } else if dryModifier(ctx, "fetch", "%v → %v", u, f.fullname()) {
+            vals = append(vals, f)
+        } else if err := fetch(ctx, u, f, ctx.sha256, ctx.force, ctx.verbose); err != nil {
+            erro(ctx, "fetch: %v", err)
+        } else {
+            vals = append(vals, f)
+        }
+    }
+    return vals
+}
+
+// __matcher declares tool matchers for recipe output, e.g.
+//
+//   eval matcher(-cmd='(^|/)mycc ', -file=1, -line=2, -message=3) '^(.+?):(\d+): (.+)$'
+//
+// Options -severity, -file, -line, -column and -message are capture indexes.
+type __matcher struct { builtinbase
+    name     string `name`
+    cmd      string `cmd,command`
+    level    string `level`
+    severity int    `severity`
+    file     int    `file`
+    line     int    `line`
+    column   int    `column,col`
+    message  int    `message,msg`
+    stdout   bool   `stdout,scan-stdout`
+}
+func (ctx *__matcher) do(c Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return &ctx.builtinbase
+	case dynamic_cast: return t.ctx(ctx, &ctx.builtinbase)
+	}
+	return ctx.builtinbase.do(c, op)
+}
+func (ctx *__matcher) x() (_ any) {
+    if ctx.cmd == "" {
+        erro(ctx, "missing -cmd, try $(matcher -cmd=regex,'line regex')")
+        return
+    }
+
+    cmd, err := regexp.Compile(ctx.cmd)
+    if err != nil {
+        erro(ctx, "bad -cmd regex: %v", err)
+        return
+    }
+
+    m := usermatcher{
+        name: warncat(ctx.name), cmd: cmd, level: diagError, stdout: ctx.stdout,
+        severity: ctx.severity, file: ctx.file, line: ctx.line, column: ctx.column, message: ctx.message,
+    }
+    if m.name == "" { m.name = "matcher" }
+    switch ctx.level {
+    case "", "error": // default
+    case "warning", "warn": m.level = diagWarn
+    case "info", "note": m.level = diagInfo
+    default: erro(ctx, "unknown matcher level '%s'", ctx.level); return
+    }
+
+    for _, a := range merge(ctx.a...) {
+        var s = __string(ctx, a)
+        if s == "" { continue }
+        rx, err := regexp.Compile("(?m)" + s) // lines keep their '\n'
+        if err != nil {
+            erro(pc(ctx, a), "bad line regex: %v", err)
+            continue
+        }
+        for _, i := range []int{m.severity, m.file, m.line, m.column, m.message} {
+            if i < 0 || rx.NumSubexp() < i {
+                erro(pc(ctx, a), "capture %d out of range (%d groups): %s", i, rx.NumSubexp(), s)
+                return
+            }
+        }
+        x := m
+        x.rx = rx
+        if u := _universe(ctx); u != nil { u.matchers.add(_position(pc(ctx, a)), &x) }
+    }
+    return
+}
+
+// __langinfo registers languages for (grep -lang=...), e.g.
+//
+//   eval langinfo(-rx='^\s*import\s+"(.+)"\s*;', -dir=proto, -suffix=.proto) myidl
+//
+// A language may also -extend a known one (its regexes and resolver rules).
+type __langinfo struct { builtinbase
+    rxs      []string `rx,re,regex`
+    sys      []string `sys,system`
+    dirs     []string `dir,dirs`
+    suffixes []string `suffix,suffixes`
+    dotted   bool     `dotted`
+    extend   string   `extend,extends`
+}
+func (ctx *__langinfo) do(c Context, op any) any {
+	switch t := op.(type) {
+	case inner_cast: return &ctx.builtinbase
+	case dynamic_cast: return t.ctx(ctx, &ctx.builtinbase)
+	}
+	return ctx.builtinbase.do(c, op)
+}
+func (ctx *__langinfo) x() (_ any) {
+    var info = new(langInfoT)
+    if ctx.extend == "" {
+        // a new language
+    } else if base := langInfo(ctx, ctx.extend); base == nil {
+        erro(ctx, "lang '%s' is unknown", ctx.extend)
+        return
+    } else {
+        *info = *base
+        info.rxs = append([]*regexp.Regexp(nil), base.rxs...)
+        info.sys = append([]*regexp.Regexp(nil), base.sys...)
+        info.dirs = append([]string(nil), base.dirs...)
+        info.suffixes = append([]string(nil), base.suffixes...)
+    }
+
+    for _, s := range ctx.rxs {
+        if rx, err := regexp.Compile(s); err != nil {
+            erro(ctx, "bad regex: %v", err)
+        } else if rx.NumSubexp() < 1 {
+            erro(ctx, "regex has no capture: %s", s)
+        } else {
+            info.rxs = append(info.rxs, rx)
+        }
+    }
+    for _, s := range ctx.sys {
+        if rx, err := regexp.Compile(s); err != nil {
+            erro(ctx, "bad regex: %v", err)
+        } else if rx.NumSubexp() < 1 {
+            erro(ctx, "regex has no capture: %s", s)
+        } else {
+            info.sys = append(info.sys, rx)
+        }
+    }
+    info.dirs = append(info.dirs, ctx.dirs...)
+    info.suffixes = append(info.suffixes, ctx.suffixes...)
+    info.dotted = info.dotted || ctx.dotted
+
+    if len(info.rxs) == 0 && len(info.sys) == 0 {
+        erro(ctx, "no grep expressions, try -rx='...' or -sys='...'")
+        return
+    }
+
+    var names = merge(ctx.a...)
+    if len(names) == 0 {
+        erro(ctx, "no language names, try $(langinfo -rx='...',name)")
+        return
+    }
+
+    var u = _universe(ctx)
+    for _, a := range names {
+        if s := __string(ctx, a); s != "" && u != nil {
+            u.langs.add(s, info)
+        }
+    }
+    return
+}
+
 type __append struct { builtinbase
     auto    bool `auto`
     closure bool `closure`
@@ -43122,7 +47681,11 @@ func (ctx *__wildcard) project(p *project, pats ...Value) {
 				var searchVal = _if_cmp(ctx, cmpSmaller, argPat, matchedPat)
 				var searchSym = __symbol(ctx, searchVal)
 				var isSearchPat = patterned(ctx, searchVal)
-				for _, matchedDir := range merge(evals(final{ctx}, matchedFile.filemap.paths...)...) {
+				var matchedDirs = merge(evals(final{ctx}, matchedFile.filemap.paths...)...)
+				if len(matchedDirs) == 0 {
+					matchedDirs = []Value{_word(NoPos, p.absPath)} // files (*.c) are in the project dir
+				}
+				for _, matchedDir := range matchedDirs {
 					dirSym := __symbol(ctx, matchedDir)
 
 					// If dirSym is relative, e.g. "src", _stat(searchSym, stat_dir{dirSym}) is nil, but
@@ -43613,12 +48176,25 @@ func (ctx *__grep) x() (_ any) {
 }
 
 var (
-    rsAutoconf  = `AC_(CHECK_(FILES?|FUNCS?|HEADERS?|PROG|SIZEOF|TOOL)|DEFINE)\(([^\)]*?)\)`
+    rsAutoconf  = `AC_(CHECK_(FILES?|FUNCS?|HEADERS?|PROG|SIZEOF|TOOL)|DEFINE)\(` // see autoconfArgs
     rsConfigRef = `[$%]\{([^\s\}]+)\}|@([^\s\@]+)@`
     rsConfigure = `^[\t ]*#[\t ]*(define|undef|smartdefine|smartdefine01|cmakedefine|cmakedefine01)[\t ]+([A-Za-z0-9_]+)(?:[\t ]+([^\n]*))?$`
     rxAutoconf  = regexp.MustCompile(rsAutoconf)
     rxConfigure = regexp.MustCompile(fmt.Sprintf(`(?m:%s)`, rsConfigure)) // m: multilines
     rxConfigRef = regexp.MustCompile(rsConfigRef)
+
+    rxMakeSubstRef = regexp.MustCompile(`\$[({]([A-Za-z0-9_.-]+):([^=(){}]*)=([^(){}]*)[)}]`)
+    rxMakeBraceRef = regexp.MustCompile(`\$\{([^{}]*)\}`)
+    rxMakeSuffixes = regexp.MustCompile(`^(\.[A-Za-z0-9_]+)(\.[A-Za-z0-9_]+)?$`)
+    rxMakeFileWord = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./+-]*(\.[A-Za-z0-9]+)$`)
+    rxMakeVarRef   = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+    rxMakeHashWord = regexp.MustCompile(`[^ \t]*#[^ \t]*`)
+
+    // makeDefaults are the builtin variables of GNU make (see make -p).
+    makeDefaults = map[string]string{
+        "AR": "ar", "AS": "as", "CC": "cc", "CXX": "g++", "CPP": "$(CC) -E",
+        "LD": "ld", "MAKE": "make", "RM": "rm -f", "SHELL": "/bin/sh",
+    }
 )
 
 func (p *project) strExpandConfig(ctx Context, s string) (result string, err error) {
@@ -43681,14 +48257,459 @@ func (p *project) strExpandConfig(ctx Context, s string) (result string, err err
     return
 }
 
+// autoconfArgs splits the arguments of a macro (s follows its `(`) on
+// top-level commas up to the balanced `)` and strips the outer [quotes],
+// e.g. `[foo.h], [bar], [[x, y]])` → foo.h, bar, [x, y]. The end is the
+// index of the `)`, or -1 if it's missing.
+func autoconfArgs(s string) (args []string, end int) {
+    var depth, parens, start int
+    var add = func(a string) {
+        a = strings.TrimSpace(a)
+        if n := len(a); n > 1 && a[0] == '[' && a[n-1] == ']' { a = a[1:n-1] }
+        args = append(args, strings.TrimSpace(a))
+    }
+    for i, c := range s {
+        switch c {
+        case '[': depth += 1
+        case ']': if depth > 0 { depth -= 1 }
+        case '(': if depth == 0 { parens += 1 }
+        case ')':
+            if depth > 0 {
+                // quoted
+            } else if parens > 0 {
+                parens -= 1
+            } else {
+                add(s[start:i])
+                return args, i
+            }
+        case ',': if depth == 0 && parens == 0 { add(s[start:i]); start = i+1 }
+        }
+    }
+    return nil, -1
+}
+
+// autoconfName mimics AS_TR_CPP: `sys/types.h` → HAVE_SYS_TYPES_H,
+// `char *` → SIZEOF_CHAR_P.
+func autoconfName(prefix, s string) string {
+    var b strings.Builder
+    b.WriteString(prefix)
+    for _, c := range strings.TrimSpace(s) {
+        switch {
+        case c == '*': b.WriteRune('P')
+        case 'a' <= c && c <= 'z': b.WriteRune(c - 'a' + 'A')
+        case 'A' <= c && c <= 'Z', '0' <= c && c <= '9': b.WriteRune(c)
+        default: b.WriteRune('_')
+        }
+    }
+    return b.String()
+}
+
+// autoconf translates the AC_CHECK_* and AC_DEFINE macros of a configure.ac
+// into a configure block, each check is a probe entry of the configure
+// toolbox (e.g. `-headers-c`), example:
+//
+//     AC_CHECK_HEADERS([stdio.h sys/types.h])
+//     AC_CHECK_SIZEOF([long])
+//
+// is translated into:
+//
+//     configure (
+//       HAVE_STDIO_H -headers-c("checking for stdio.h") = stdio.h
+//       HAVE_SYS_TYPES_H -headers-c("checking for sys/types.h") = sys/types.h
+//       SIZEOF_LONG -sizeof-c("checking size of long") = long
+//     )
+//
 // https://www.gnu.org/software/autoconf/manual/autoconf-2.67/autoconf.html
 func autoconf(ctx Context, out *bytes.Buffer, p *project, str string) (err error) {
+    var lines []string
+    for _, s := range strings.Split(str, "\n") {
+        if t := strings.TrimSpace(s); strings.HasPrefix(t, "dnl") || strings.HasPrefix(t, "#") {
+            continue // comments
+        }
+        lines = append(lines, s)
+    }
+
     var num int
-    for _, m := range rxAutoconf.FindAllStringSubmatch(str, -1) {
-        info(ctx, "TODO: %v", m)
+    var seen = make(map[string]bool)
+    var probe = func(name, op, info, val string) {
+        if seen[name] { return } else { seen[name] = true }
+        if strings.ContainsAny(val, " \t") { val = strconv.Quote(val) }
+        if op == "" {
+            fmt.Fprintf(out, "  %s = %s\n", name, val)
+        } else {
+            fmt.Fprintf(out, "  %s -%s(%s) = %s\n", name, op, strconv.Quote(info), val)
+        }
+        num += 1
+    }
+
+    fmt.Fprintf(out, "configure (\n")
+    var text = strings.Join(lines, "\n")
+    for _, loc := range rxAutoconf.FindAllStringSubmatchIndex(text, -1) {
+        var name, call = text[loc[2]:loc[3]], text[loc[0]:loc[1]]
+        var args, end = autoconfArgs(text[loc[1]:])
+        if end < 0 {
+            warn(ctx, "%s: missing ')'", call)
+            continue
+        } else if call = text[loc[0]:loc[1]+end+1]; len(args) == 0 || args[0] == "" {
+            warn(ctx, "%s: missing arguments", call)
+            continue
+        }
+        switch name {
+        case "CHECK_HEADER", "CHECK_HEADERS":
+            for _, s := range strings.Fields(args[0]) {
+                probe(autoconfName("HAVE_", s), "headers-c", "checking for "+s, s)
+            }
+        case "CHECK_FUNC", "CHECK_FUNCS":
+            for _, s := range strings.Fields(args[0]) {
+                probe(autoconfName("HAVE_", s), "function-c", "checking for "+s, s)
+            }
+        case "CHECK_FILE", "CHECK_FILES":
+            for _, s := range strings.Fields(args[0]) {
+                probe(autoconfName("HAVE_", s), "file-exists", "checking for "+s, s)
+            }
+        case "CHECK_SIZEOF":
+            probe(autoconfName("SIZEOF_", args[0]), "sizeof-c", "checking size of "+args[0], args[0])
+        case "CHECK_PROG", "CHECK_TOOL":
+            if len(args) < 2 || args[1] == "" {
+                warn(ctx, "%s: missing program", call)
+            } else {
+                probe(args[0], "program", "checking for "+args[1], args[1])
+            }
+        case "DEFINE":
+            if len(args) < 2 || args[1] == "" {
+                probe(args[0], "answer", "defining "+args[0], "1")
+            } else {
+                probe(args[0], "", "", args[1])
+            }
+        default:
+            debug(ctx, "%s: unsupported", call)
+        }
+    }
+    fmt.Fprintf(out, ")\n")
+
+    if num == 0 {
+        err = fmt.Errorf("no autoconf checks")
+    } else if false {
+        debug(ctx, "autoconf: %d checks\n%s", num, out)
+    }
+    return
+}
+
+// makeRefs rewrites the variable references the smart syntax lacks,
+// `${VAR}` → `$(VAR)` and `$(VAR:.c=.o)` → `$(patsubst %.c,%.o,$(VAR))`,
+// the escaped `$$` (e.g. `$${HOME}` of the shell) is kept as in smart.
+func makeRefs(s string) string {
+    var a = strings.Split(s, "$$")
+    for i, s := range a {
+        s = rxMakeSubstRef.ReplaceAllStringFunc(s, func(ref string) string {
+            var m = rxMakeSubstRef.FindStringSubmatch(ref)
+            var from, to = m[2], m[3]
+            if !strings.Contains(from, "%") { from, to = "%"+from, "%"+to }
+            return fmt.Sprintf("$(patsubst %s,%s,$(%s))", from, to, m[1])
+        })
+        a[i] = rxMakeBraceRef.ReplaceAllString(s, "$$($1)")
+    }
+    return strings.Join(a, "$$")
+}
+
+// makeComment strips the comment of a line, the escaped `\#` is a `#`
+// which is quoted for smart (e.g. `a\#b` gives `"a#b"`).
+func makeComment(s string) string {
+    for i := 0; i < len(s); i++ {
+        if s[i] == '#' && (i == 0 || s[i-1] != '\\') {
+            s = s[:i]
+            break
+        }
+    }
+    if strings.Contains(s, `\#`) {
+        s = rxMakeHashWord.ReplaceAllStringFunc(strings.ReplaceAll(s, `\#`, "#"), strconv.Quote)
+    }
+    return s
+}
+
+// makeIndex returns the index of the first c (one of chars) outside of
+// $(...) and ${...} references, or -1.
+func makeIndex(s, chars string) int {
+    var depth int
+    for i, c := range s {
+        switch {
+        case c == '(' || c == '{': depth += 1
+        case c == ')' || c == '}': if depth > 0 { depth -= 1 }
+        case depth == 0 && strings.ContainsRune(chars, c): return i
+        }
+    }
+    return -1
+}
+
+type makerule struct {
+    targets, prereqs []string
+    recipe []string
+}
+
+// makefile translates a practical subset of GNU make into defs and rules:
+// variables (=, :=, ::=, +=, ?=, !=), explicit, pattern (%) and suffix
+// rules (.c.o), include (-include, sinclude), .PHONY and the .PRECIOUS,
+// .INTERMEDIATE and .SECONDARY targets (as rule modifiers), example:
+//
+//     SRCS = main.c util.c
+//     prog: $(SRCS:.c=.o)
+//     	$(CC) -o $@ $^
+//     %.o: %.c
+//     	$(CC) -c -o $@ $<
+//
+// is translated into:
+//
+//     CC ?= cc
+//     SRCS = main.c util.c
+//     files (
+//       prog
+//       *.c
+//       *.o
+//     )
+//     prog: $(patsubst %.c,%.o,$(SRCS)) {(shell)}
+//     	$(CC) -o $@ $^
+//     %.o: %.c {(shell)}
+//     	$(CC) -c -o $@ $<
+//
+// Defs are placed before the rules (make expands targets and prerequisites
+// when reading), conditionals and define blocks are skipped with a warning.
+//
+// https://www.gnu.org/software/make/manual/make.html
+func makefile(ctx Context, out *bytes.Buffer, str string) (err error) {
+    var (
+        defs  []string
+        rules []*makerule
+        rule  *makerule
+        marks = make(map[string][]string) // target → modifiers
+        phony = make(map[string]bool)
+        skip  []string // conditionals and define being skipped
+        num   int
+    )
+
+    var assigned = make(map[string]string) // name → the first assign op
+    var lines = strings.Split(strings.ReplaceAll(str, "\r\n", "\n"), "\n")
+    for i := 0; i < len(lines); i++ {
+        var line, lineno = lines[i], i+1
+        for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+            i += 1 // continued line
+            line = strings.TrimRight(strings.TrimSuffix(line, "\\"), " \t") + " " + strings.TrimLeft(lines[i], " \t")
+        }
+
+        if strings.HasPrefix(line, "\t") && rule != nil && len(skip) == 0 {
+            var s = strings.TrimLeft(line, " \t")
+            if s == "" || s[0] == '#' { continue }
+            var ignore = false
+            for len(s) > 0 && strings.ContainsRune("@+-", rune(s[0])) {
+                if s[0] == '-' { ignore = true }
+                s = strings.TrimLeft(s[1:], " \t")
+            }
+            if s = makeRefs(s); ignore { s += " || true" }
+            rule.recipe = append(rule.recipe, s)
+            continue
+        }
+
+        if line = strings.TrimSpace(makeComment(line)); line == "" { continue }
+
+        var word, rest = line, ""
+        if n := strings.IndexAny(line, " \t"); n > 0 {
+            word, rest = line[:n], strings.TrimSpace(line[n:])
+        }
+        if len(skip) > 0 {
+            switch word {
+            case "ifeq", "ifneq", "ifdef", "ifndef": skip = append(skip, "endif")
+            case "define": skip = append(skip, "endef")
+            case skip[len(skip)-1]: skip = skip[:len(skip)-1]
+            }
+            continue
+        }
+
+        switch word {
+        case "ifeq", "ifneq", "ifdef", "ifndef":
+            warn(ctx, "line %d: unsupported conditional '%s' skipped", lineno, line)
+            skip, rule = append(skip, "endif"), nil
+            continue
+        case "define":
+            warn(ctx, "line %d: unsupported define '%s' skipped", lineno, rest)
+            skip, rule = append(skip, "endef"), nil
+            continue
+        case "include", "-include", "sinclude":
+            for _, s := range strings.Fields(makeRefs(rest)) {
+                if word == "include" {
+                    defs = append(defs, "include -make "+s)
+                } else {
+                    defs = append(defs, "include -make -if-exists "+s)
+                }
+            }
+            rule = nil
+            continue
+        case "export", "unexport", "override":
+            if makeIndex(rest, "=") < 0 {
+                debug(ctx, "line %d: '%s' ignored", lineno, line)
+                continue
+            }
+            line = rest // override VAR = value
+        case "vpath":
+            debug(ctx, "line %d: '%s' ignored", lineno, line)
+            continue
+        }
+
+        var colon, equal = makeIndex(line, ":"), makeIndex(line, "=")
+        if equal > 0 && (colon < 0 || equal < colon || strings.HasPrefix(line[colon:], ":=") || strings.HasPrefix(line[colon:], "::=")) {
+            var name, op = line[:equal], "="
+            if colon >= 0 && colon < equal { name, op = line[:colon], line[colon:equal+1] }
+            if n := len(name); n > 0 && strings.ContainsRune("+?!", rune(name[n-1])) {
+                name, op = name[:n-1], name[n-1:]+op
+            }
+            var value = strings.TrimSpace(makeRefs(line[equal+1:]))
+            if name = strings.TrimSpace(name); name == "" || strings.ContainsAny(name, " \t") {
+                warn(ctx, "line %d: invalid variable '%s'", lineno, name)
+                rule = nil
+                continue
+            } else if _, ok := assigned[name]; !ok {
+                assigned[name] = op
+            }
+            if value == "" {
+                defs = append(defs, name+" "+op)
+            } else {
+                defs = append(defs, name+" "+op+" "+value)
+            }
+            rule = nil
+            continue
+        } else if colon < 0 {
+            warn(ctx, "line %d: unsupported '%s'", lineno, line)
+            rule = nil
+            continue
+        }
+
+        var targets = strings.Fields(makeRefs(line[:colon]))
+        var prereqs, recipe = strings.TrimLeft(line[colon+1:], ":"), ""
+        if n := makeIndex(prereqs, ";"); n >= 0 {
+            prereqs, recipe = prereqs[:n], strings.TrimSpace(prereqs[n+1:])
+        }
+        if makeIndex(prereqs, "=") >= 0 {
+            warn(ctx, "line %d: unsupported target-specific variable '%s'", lineno, line)
+            rule = nil
+            continue
+        }
+
+        rule = &makerule{ targets: targets, prereqs: strings.Fields(makeRefs(prereqs)) }
+        if len(targets) == 1 && strings.HasPrefix(targets[0], ".") {
+            switch s := targets[0]; s {
+            case ".PHONY":
+                for _, s := range rule.prereqs { phony[s] = true }
+                rule = nil
+                continue
+            case ".PRECIOUS", ".INTERMEDIATE", ".SECONDARY":
+                var mark = "("+strings.ToLower(s[1:])+")"
+                for _, s := range rule.prereqs { marks[s] = append(marks[s], mark) }
+                rule = nil
+                continue
+            case ".DEFAULT", ".SUFFIXES", ".DELETE_ON_ERROR", ".NOTPARALLEL", ".ONESHELL", ".SILENT", ".EXPORT_ALL_VARIABLES", ".POSIX":
+                debug(ctx, "line %d: '%s' ignored", lineno, s)
+                rule = nil
+                continue
+            default:
+                if m := rxMakeSuffixes.FindStringSubmatch(s); m != nil && len(rule.prereqs) == 0 {
+                    if m[2] == "" {
+                        rule.targets = []string{"%"} // .c: → %: %.c
+                    } else {
+                        rule.targets = []string{"%"+m[2]} // .c.o: → %.o: %.c
+                    }
+                    rule.prereqs = []string{"%"+m[1]}
+                }
+            }
+        }
+        if recipe != "" { rule.recipe = append(rule.recipe, makeRefs(recipe)) }
+        rules = append(rules, rule)
+    }
+    if len(skip) > 0 {
+        warn(ctx, "missing '%s'", skip[len(skip)-1])
+    }
+
+    // Targets and prerequisites are files unless .PHONY (or references),
+    // a pattern gives its glob (e.g. %.o gives *.o), a file name gives its
+    // suffix glob (e.g. *.c), the match-anything % (e.g. of .c:) is none.
+    var words = func(s string) []string {
+        return strings.FieldsFunc(s, func(c rune) bool { return c == ' ' || c == '\t' || c == ',' })
+    }
+    var files []string
+    var seen = make(map[string]bool)
+    var addFile = func(s string) {
+        if phony[s] || seen[s] || s == "|" || s == "%" || strings.ContainsAny(s, "$()") { return }
+        if strings.Contains(s, "%") {
+            s = strings.ReplaceAll(s, "%", "*")
+        } else if m := rxMakeFileWord.FindStringSubmatch(s); m != nil {
+            s = "*"+m[1]
+        }
+        if !seen[s] { files = append(files, s) }
+        seen[s] = true
+    }
+    for _, r := range rules {
+        for _, s := range words(strings.Join(append(r.targets, r.prereqs...), " ")) { addFile(s) }
+    }
+
+    // Variables not assigned (or appended first) are taken from the
+    // environment or the make defaults, others are empty as in make.
+    var refs []string
+    var addRefs = func(a ...string) {
+        for _, s := range a {
+            s = strings.ReplaceAll(s, "$$", "") // e.g. $$(pwd) of the shell
+            for _, m := range rxMakeVarRef.FindAllStringSubmatch(s, -1) {
+                if !slices.Contains(refs, m[1]) { refs = append(refs, m[1]) }
+            }
+        }
+    }
+    for name, op := range assigned {
+        if op == "+=" || op == "?=" { refs = append(refs, name) }
+    }
+    slices.Sort(refs)
+    addRefs(defs...)
+    for _, r := range rules {
+        addRefs(r.targets...)
+        addRefs(r.prereqs...)
+        addRefs(r.recipe...)
+    }
+    for _, name := range refs {
+        var value, ok = os.LookupEnv(name)
+        if !ok { value, ok = makeDefaults[name] }
+        switch op, assign := assigned[name]; {
+        case assign && op != "+=" && op != "?=":
+        case ok && value != "":
+            fmt.Fprintf(out, "%s ?= %s\n", name, value)
+        case op != "?=":
+            fmt.Fprintf(out, "%s ?=\n", name)
+        }
+    }
+
+    for _, s := range defs {
+        fmt.Fprintf(out, "%s\n", s)
         num += 1
     }
-    debug(ctx, "TODO: %d", num)
+    if len(files) > 0 {
+        fmt.Fprintf(out, "\nfiles (\n")
+        for _, s := range files { fmt.Fprintf(out, "  %s\n", s) }
+        fmt.Fprintf(out, ")\n")
+    }
+    for _, r := range rules {
+        var mods []string
+        if len(r.recipe) > 0 { mods = append(mods, "(shell)") }
+        for _, s := range r.targets {
+            for _, s := range marks[s] {
+                if !slices.Contains(mods, s) { mods = append(mods, s) }
+            }
+        }
+
+        fmt.Fprintf(out, "\n%s:", strings.Join(r.targets, " "))
+        if len(r.prereqs) > 0 { fmt.Fprintf(out, " %s", strings.Join(r.prereqs, " ")) }
+        if len(mods) > 0 { fmt.Fprintf(out, " {%s}", strings.Join(mods, " ")) }
+        fmt.Fprintf(out, "\n")
+        for _, s := range r.recipe { fmt.Fprintf(out, "\t%s\n", s) }
+        num += 1
+    }
+
+    if num == 0 {
+        err = fmt.Errorf("no make variables or rules")
+    }
     return
 }
 
@@ -43946,6 +48967,108 @@ Basic:
    -reconfigure
     Reconfigures all projects underneath the work directory.
 
+   -test
+    Run test-* rules of all loaded projects in temporary work directories,
+    goals select tests by name pattern, -junit=<file> writes a JUnit report.
+
+   -repl
+    Load the main project and read expressions, defs, rules and modifier
+    groups interactively, printing the results with their types, with
+    history (arrows) and tab completion of builtins, defs and rules.
+
+   -config-show
+   -config-set NAME=VALUE, -config-set(NAME=VALUE ...)
+   -config-unset NAME, -config-unset(NAME ...)
+    Show the cached configuration (configuration.sm) with origins and probes,
+    pin a value (never probed again) or drop it (probed again on next run),
+    NAME is either a config of the main project or PROJECT.NAME.
+
+   -debug-vm
+   -debug-vm-step
+    Disassemble and trace every step of the pattern/expansion VM (ops,
+    operands, tape, stems and backtracks), -debug-vm-step waits for a
+    command after each step (enter to step, "c" to continue the VM).
+
+   -diag-format=json|sarif
+   -diag-output=FILE
+    Write the errors, warnings and infos as JSON lines or a SARIF log (at
+    exit) with positions, rule, call stack and sub-messages (related
+    locations), to FILE instead of stderr.
+
+   -max-errors=N
+   -Werror
+   -no-warn(CATEGORY ...)
+    Stop after N errors (negative for no limit), turn warnings into errors,
+    or disable the warnings of the categories (e.g. deprecated, deps,
+    configure, inputs, or all). A "# smart:nowarn [CATEGORY ...]" comment silences
+    the warnings of its line (or the next line if it's on its own).
+
+   -n, -dry-run
+    Don't execute but print the recipes (fully expanded, in dependency
+    order) of the targets which would be updated, each preceded by the
+    target and why it's outdated, the dialect, the working directory and
+    the (env) variables. Modifiers writing files ((download), (extract),
+    (archive), (write-file), (extract-configuration)) print what they would
+    do as "# (name) ..." lines.
+
+   -clean
+   -distclean
+    Remove the files produced by the rules reachable from the goals (without
+    running the recipes and the modifiers other than (precious)) and the
+    files stamped for them by earlier builds (e.g. by (extract)), except
+    the (precious) ones and the ones matching the project's .precious
+    patterns; -distclean also removes the temp dirs of the projects. With
+    -dry (or -n), only list them.
+
+   -delete-on-error
+    Remove the target of a failed recipe (like (shell -remove-on-fail)),
+    which is always done when interrupted, unless the rule marks it
+    (precious) or matches the project's .precious patterns. Rules may
+    also mark targets (intermediate) or (secondary), intermediates made by
+    the build are removed after it unless (secondary) or precious.
+
+   -auto-intermediate
+    Also mark (intermediate) the targets of pattern rules which are
+    prerequisites of other pattern rules (chained pattern rules).
+
+   -j=N, -jobs=N
+   -jobserver-style=fifo|pipe
+    Be a GNU make jobserver of N slots (fifo by default), shared with the
+    child builds (make, ninja, cargo, smart, ...) via MAKEFLAGS. Without it,
+    the jobserver of MAKEFLAGS is joined if smart is run by make -jN. Each
+    recipe and (fork) takes a slot, with -parallel the prerequisites are
+    traversed by up to N workers (3 without a jobserver) holding one.
+
+   -toolchain=NAME
+    Select the toolchain profile .smart/toolchains/NAME, which is a list of
+    NAME = value lines defined for recipes and configure probes. CC and CXX
+    (with any wrapper, e.g. ccache gcc) are used by (extract-deps), SYSROOT
+    and TARGET by (extract-deps) and (grep). Each profile has its own temp
+    dirs and configuration.sm.
+
+   -sandbox
+   -sandbox-allow(PATH ...)
+   -sandbox-helper=bwrap
+    Run each recipe in a Linux user/mount namespace (bubblewrap) which only
+    exposes the tool dirs (/usr, /etc, PATH, ...), the allowed paths and the
+    prerequisites (read-only), and report reads of files outside them as
+    undeclared dependencies. The target is written in a scratch directory
+    and moved into place when the recipe succeeds.
+
+   -trace-inputs
+   -trace-inputs-record
+   -trace-helper=strace
+    Trace the files opened by each recipe (strace -f) and warn about the
+    ones which are neither prerequisites nor grepped or (deps) files nor in
+    the tool dirs (warning category "inputs"), or record them to be treated
+    as discovered dependencies of the target by the next runs.
+
+   -grep-cache-stats
+   -grep-cache-dump[(TARGET ...)]
+    Show the size, records (live and dead) and state of the binary grep
+    dependency cache, or list the grepped files cached for the targets
+    (full paths or trailing path components, all without TARGET).
+
 `)
 
     print_flag_entries(ctx)
@@ -0,0 +1,1045 @@
+package smart
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	enc_bin "encoding/binary"
+	enc_xml "encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	time_pkg "time"
+)
+
+// TestRunTests runs testdata/test with -test and checks that the recipes,
+// (assert) and $(skip) of the test rules are executed.
+func TestRunTests(t *testing.T) {
+	var dir, err = filepath.Abs(filepath.Join("testdata", "test"))
+	if err != nil { t.Fatal(err) }
+
+	// not t.TempDir, whose numbered elements don't survive option parsing
+	var tmp string
+	if tmp, err = os.MkdirTemp("", "smart-test-"); err != nil { t.Fatal(err) }
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+
+	var marker = filepath.Join(tmp, "marker")
+	var report = filepath.Join(tmp, "junit.xml")
+	t.Setenv("SMART_TEST_MARKER", marker)
+
+	var u = new_universe(workdir_sym(intern(dir)), []string{"-test", "-junit-xml=" + report})
+	u.load(main_ctx{u})
+	if u.flush(u) > 0 { t.Fatalf("%s: loading failed", dir) }
+	if n := u.test(main_ctx{u}); n != 1 {
+		t.Errorf("failed tests: %d, want 1", n)
+	}
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("test-recipe did not run: %v", err)
+	}
+
+	var doc junitTestsuites
+	if b, err := os.ReadFile(report); err != nil {
+		t.Fatal(err)
+	} else if err = enc_xml.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Suites) != 1 {
+		t.Fatalf("suites: %d, want 1", len(doc.Suites))
+	}
+
+	var s = doc.Suites[0]
+	if s.Tests != 3 || s.Failures != 1 || s.Skipped != 1 {
+		t.Errorf("tests=%d failures=%d skipped=%d, want 3, 1, 1", s.Tests, s.Failures, s.Skipped)
+	}
+	for _, c := range s.Cases {
+		var failed, skipped = c.Failure != nil, c.Skipped != nil
+		if failed != (c.Name == "test-assert") || skipped != (c.Name == "test-skip") {
+			t.Errorf("%s: failed=%v skipped=%v", c.Name, failed, skipped)
+		}
+	}
+}
+
+// TestGrepLangs greps the sources of testdata/grep with the regexes of
+// langInfos and resolves the names like (grep -lang=...) does.
+func TestGrepLangs(t *testing.T) {
+	var dir, err = filepath.Abs(filepath.Join("testdata", "grep"))
+	if err != nil { t.Fatal(err) }
+
+	var u = new_universe(workdir_sym(intern(dir)), []string{})
+	for _, c := range []struct{ lang, file string; want []string }{
+		{"go", "main.go", []string{"fmt", "os", "strings"}},
+		{"python", "pkg/a.py", []string{"./b.py", "./c.py", "../top.py"}},
+	} {
+		var b, err = os.ReadFile(filepath.Join(dir, c.file))
+		if err != nil { t.Fatal(err) }
+
+		var gc = grep_ctx{modifier_grep: new(modifier_grep)}
+		gc.dir = intern(filepath.Dir(filepath.Join(dir, c.file)))
+		gc.addLang(langInfo(main_ctx{u}, c.lang))
+
+		var got []string
+		var block *langblock
+		for _, s := range strings.Split(string(b), "\n") {
+			if x, name, _ := gc.grepline(s, &block); x != nil {
+				got = append(got, x.lang.resolve(main_ctx{u}, &gc, name))
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Errorf("%s: %v, want %v", c.file, got, c.want)
+		}
+	}
+}
+
+// TestGrepCache encodes grep cache records, a later record of a key and
+// options replaces the earlier one, and a bad header, checksum or a torn
+// tail stops reading at the last good record.
+func TestGrepCache(t *testing.T) {
+	var records = []grepcacherecord{
+		{key: "/p/a.o", opts: "-lang=c", mtime: 1, grepped: 2, files: [][3]string{{"a.h", "", "/p"}, {"/usr/include/stdio.h", "", ""}}},
+		{key: "/p/b.o", opts: "-lang=c", mtime: -1, grepped: 0},
+		{key: "/p/a.o", opts: "-lang=c", mtime: 3, grepped: 4, files: [][3]string{{"b.h", "inc", "/p"}}},
+		{key: "/p/a.o", opts: "-lang=c -sys=\"x\"", mtime: 5, grepped: 6},
+	}
+	var data = append([]byte(grepCacheMagic), 0, 0)
+	enc_bin.LittleEndian.PutUint16(data[len(grepCacheMagic):], grepCacheVersion)
+	var sizes = []int{len(data)}
+	for i := range records {
+		data = records[i].encode(data)
+		sizes = append(sizes, len(data))
+	}
+
+	var live = make(map[string]grepcacherecord)
+	var read = func(data []byte) (n int, size int64, ok bool) {
+		live = make(map[string]grepcacherecord)
+		return readGrepCache(data, func(r *grepcacherecord) { live[r.key+" "+r.opts] = *r })
+	}
+	if n, size, ok := read(data); !ok || n != len(records) || size != int64(len(data)) {
+		t.Fatalf("read: %d records, %d bytes, ok=%v", n, size, ok)
+	} else if r := live["/p/a.o -lang=c"]; r.mtime != 3 || r.grepped != 4 || fmt.Sprint(r.files) != "[[b.h inc /p]]" {
+		t.Errorf("later record: %+v", r)
+	} else if len(live) != 3 || live["/p/b.o -lang=c"].mtime != -1 {
+		t.Errorf("live: %+v", live)
+	}
+
+	for _, x := range []struct{ name string; data []byte; records int }{
+		{"torn", data[:len(data)-3], 3},
+		{"checksum", func() []byte { var b = bytes.Clone(data); b[sizes[1]+2] ^= 0xff; return b }(), 1},
+		{"version", func() []byte { var b = bytes.Clone(data); b[len(grepCacheMagic)] += 1; return b }(), 0},
+		{"magic", append([]byte("XXXX"), data[4:]...), 0},
+		{"empty", nil, 0},
+	} {
+		if n, size, ok := read(x.data); ok || n != x.records || x.records > 0 && size != int64(sizes[x.records]) {
+			t.Errorf("%s: %d records, %d bytes, ok=%v", x.name, n, size, ok)
+		}
+	}
+
+	grepcacheM.Lock(); defer grepcacheM.Unlock()
+	var k = intern("/p/grepcache-test.o")
+	defer delete(grepcache, k)
+	var a, b = _word(NoPos, intern("a.h")), _word(NoPos, intern("b.h"))
+	grepcachePut(k, grepentry{"-lang=c", 1, 1, []Value{a}})
+	grepcachePut(k, grepentry{"-lang=c++", 1, 1, []Value{a}})
+	grepcachePut(k, grepentry{"-lang=c", 2, 2, []Value{b}})
+	if e, ok := grepcacheGet(k, "-lang=c"); !ok || e.mtime != 2 || len(e.files) != 1 || e.files[0] != b {
+		t.Errorf("put: %+v", e)
+	} else if len(grepcache[k]) != 2 {
+		t.Errorf("entries: %+v", grepcache[k])
+	}
+	grepcachePut(k, grepentry{"-lang=c", 3, 3, nil}) // no files drops it
+	grepcachePut(k, grepentry{"-lang=c++", 3, 3, nil})
+	if _, ok := grepcacheGet(k, "-lang=c"); ok || grepcache[k] != nil {
+		t.Errorf("dropped: %+v", grepcache[k])
+	}
+}
+
+// TestConfig pins a configure result with -config-set and drops another
+// one with -config-unset, the next load only probes the dropped one.
+func TestConfig(t *testing.T) {
+	var dir = testDir(t, map[string]string{
+		"do.smart": "project cfg\n\nconfigure (\n  FOO -answer(\"foo\") = 1\n  BAR -answer(\"bar\") = 2\n)\n",
+	})
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	var config = func(args ...string) (errs int, sm string) {
+		var u = new_universe(workdir_sym(intern(dir)), args)
+		defer u.teardown()
+		out.Reset()
+		if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil {
+			t.Fatalf("%v: loading failed\n%s", args, out.String())
+		}
+		var f = u.globe.main.configuration_sm(u)
+		t.Cleanup(func() { os.RemoveAll(filepath.Dir(f.fullname().String())) })
+		if len(args) > 0 { errs = u.config(main_ctx{u}) }
+		var b, _ = os.ReadFile(f.fullname().String())
+		return errs, string(b)
+	}
+	var configs = func(sm string) (s []string) {
+		for _, line := range strings.Split(sm, "\n") {
+			if strings.HasPrefix(line, "configure ") { s = append(s, line) }
+		}
+		return
+	}
+
+	if _, sm := config(); strings.Join(configs(sm), "; ") != "configure FOO = {yes}; configure BAR = {yes}" {
+		t.Errorf("configured:\n%s", sm)
+	}
+	if n, sm := config("-config-set", "FOO=42", "-config-unset", "BAR"); n > 0 {
+		t.Errorf("-config-set: %d errors\n%s", n, out.String())
+	} else if strings.Join(configs(sm), "; ") != "configure FOO -pinned = 42" {
+		t.Errorf("-config-set:\n%s", sm)
+	}
+	if n, sm := config("-config-show"); n > 0 || strings.Join(configs(sm), "; ") != "configure FOO -pinned = 42; configure BAR = {yes}" {
+		t.Errorf("reloaded:\n%s", sm)
+	} else if s := out.String(); strings.Contains(s, "foo") || !strings.Contains(s, "bar") {
+		t.Errorf("probed:\n%s", s) // FOO is pinned, BAR is probed again
+	} else if !regexp.MustCompile(`FOO = 42 .*pinned`).MatchString(s) {
+		t.Errorf("-config-show:\n%s", s)
+	}
+	if n, sm := config("-config-set", "cfg.BAR=x", "-config-unset", "NONE"); n > 0 {
+		t.Errorf("cfg.BAR: %d errors\n%s", n, out.String())
+	} else if !strings.Contains(sm, "configure BAR -pinned = x") || !strings.Contains(out.String(), "no config NONE") {
+		t.Errorf("cfg.BAR:\n%s\n%s", sm, out.String())
+	}
+	if n, _ := config("-config-set", "FOO"); n != 1 {
+		t.Errorf("-config-set FOO: %d errors\n%s", n, out.String())
+	}
+}
+
+// TestToolchain selects a -toolchain profile: its variables are defined
+// in the globe, it has its own temp dirs and its SYSROOT resolves the
+// system includes.
+func TestToolchain(t *testing.T) {
+	var sysroot = testDir(t, map[string]string{"usr/include/zlib.h": ""})
+	var dir = testDir(t, map[string]string{
+		"do.smart": "project tc\n",
+		".smart/toolchains/cross": "# a cross toolchain\nCC = cross-gcc -O2\nAR = cross-ar\n" +
+			"SYSROOT = " + sysroot + "\nTARGET = aarch64-linux-gnu\n",
+	})
+	var load = func(args ...string) (u *universe, c Context) {
+		u = new_universe(workdir_sym(intern(dir)), args)
+		t.Cleanup(u.teardown)
+		if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil {
+			t.Fatalf("%v: loading failed", args)
+		}
+		t.Cleanup(func() { os.RemoveAll(u.globe.main.tempdirSym(u).String()) })
+		return u, closure_with(main_ctx{u}, u.globe.main.scope)
+	}
+
+	var host, hc = load()
+	var u, c = load("-toolchain=cross")
+	for _, x := range []struct{ name, host, cross string }{
+		{"CC", "", "cross-gcc -O2"},
+		{"AR", "", "cross-ar"},
+		{"SYSROOT", "", sysroot},
+		{"TARGET", "", "aarch64-linux-gnu"},
+		{"TOOLCHAIN", "", "cross"},
+	} {
+		if s := host.toolchainVar(hc, x.name); s != x.host {
+			t.Errorf("host %s = %q", x.name, s)
+		}
+		if s := u.toolchainVar(c, x.name); s != x.cross {
+			t.Errorf("cross %s = %q, want %q", x.name, s, x.cross)
+		}
+	}
+
+	var tmp, hostTmp = u.globe.main.tempdirSym(c).String(), host.globe.main.tempdirSym(hc).String()
+	if tmp == hostTmp || !strings.Contains(tmp, "/.smart/tmp-cross/") {
+		t.Errorf("temp dirs: %s, %s", tmp, hostTmp)
+	} else if f := u.globe.main.configuration_sm(c); f == nil || !strings.HasPrefix(f.fullname().String(), tmp) {
+		t.Errorf("configuration.sm: %v", f)
+	}
+
+	var gc = grep_ctx{modifier_grep: new(modifier_grep)}
+	gc.dir = u.globe.main.absPath
+	if gc.cachekey(c); !strings.Contains(gc.opts, "SYSROOT="+sysroot) {
+		t.Errorf("grep cache key: %q", gc.opts)
+	}
+	if f := searchGreppedName(c, Position{}, &gc, true, intern("zlib.h")); f == nil || f.fullname().String() != filepath.Join(sysroot, "usr/include/zlib.h") {
+		t.Errorf("<zlib.h>: %v", f)
+	} else if f = searchGreppedName(hc, Position{}, &gc, true, intern("zlib.h")); f != nil && f.exists() {
+		t.Errorf("host <zlib.h>: %v", f.fullname())
+	}
+
+	var errs bytes.Buffer
+	var x = New(WithWorkdir(dir), WithArgs("-toolchain=none"), WithStdout(io.Discard), WithStderr(&errs))
+	defer x.Close()
+	if err := x.Load(); err == nil || !strings.Contains(errs.String(), "toolchain 'none' not found") {
+		t.Errorf("-toolchain=none: %v\n%s", err, errs.String())
+	}
+}
+
+// TestLangInfo registers languages with $(langinfo), a new one and one
+// extending c, they're only known to the universe which evaluated them.
+func TestLangInfo(t *testing.T) {
+	var c, _ = testProject(t, map[string]string{
+		"do.smart": "project langs\n\n" +
+			"eval langinfo(-rx='^\\s*import\\s+\"(.+)\"\\s*;', -dir=proto, -suffix=.idl) myidl\n" +
+			"eval langinfo(-extend=c, -rx='^\\s*#\\s*embed\\s*\"(.+)\"', -suffix=.h) myc\n",
+		"proto/b.idl": "",
+	})
+	var idl, myc = langInfo(c, "myidl"), langInfo(c, "myc")
+	if idl == nil || myc == nil {
+		t.Fatalf("langs: myidl=%v myc=%v", idl, myc)
+	}
+	if len(idl.rxs) != 1 || strings.Join(idl.dirs, " ") != "proto" || strings.Join(idl.suffixes, " ") != ".idl" {
+		t.Errorf("myidl: %v %v %v", idl.rxs, idl.dirs, idl.suffixes)
+	}
+	var base = langInfos["c"]
+	if len(myc.rxs) != len(base.rxs)+1 || len(myc.sys) != len(base.sys) || strings.Join(myc.suffixes, " ") != ".h" {
+		t.Errorf("myc: %v %v %v", myc.rxs, myc.sys, myc.suffixes)
+	}
+	if len(base.rxs) != 1 || len(base.suffixes) != 0 {
+		t.Errorf("c is changed: %v %v", base.rxs, base.suffixes)
+	}
+
+	var gc = grep_ctx{modifier_grep: new(modifier_grep)}
+	gc.langs = []string{"myidl"}
+	gc.dir = _project(c).absPath
+	gc.cachekey(c)
+	gc.addLang(idl)
+	var block *langblock
+	if x, name, _ := gc.grepline(`import "b";`, &block); x == nil || name != "b" {
+		t.Errorf("grep: %v %q", x, name)
+	} else if s := x.lang.resolve(c, &gc, name); s != "b.idl" && !strings.HasSuffix(s, "proto/b.idl") {
+		t.Errorf("resolve: %q", s)
+	}
+	if !strings.Contains(gc.opts, "-lang=myidl(rx=") {
+		t.Errorf("cache key: %q", gc.opts)
+	}
+
+	// another universe doesn't know them
+	var u = new_universe(workdir_sym(intern(t.TempDir())), []string{})
+	if info := langInfo(main_ctx{u}, "myidl"); info != nil || langInfos["myidl"] != nil {
+		t.Errorf("myidl is global")
+	}
+
+	// no names and an unknown base are errors, nothing is registered
+	u = new_universe(workdir_sym(intern(testDir(t, map[string]string{
+		"do.smart": "project nonames\n\neval langinfo(-rx='^use (.+)')\n" +
+			"eval langinfo(-extend=nolang) foo\n",
+	}))), []string{})
+	if u.load(main_ctx{u}); u.erros != 2 || len(u.langs.m) != 0 {
+		t.Errorf("errors: %d %v", u.erros, u.langs.m)
+	}
+}
+
+// BenchmarkBlobs compares carrying an object as a VM-local blob (see
+// symstr.bindBlob) with interning an ephemeral symbol of the vocabulary
+// from parallel workers, the latter contends on the vocabulary locks.
+func BenchmarkBlobs(b *testing.B) {
+	var obj = &closure{delegate{l: LPAREN, x: _word(NoPos, intern("foo"))}}
+	var face = intern("blob.face")
+	b.Run("symstr", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			var s symstr
+			for pb.Next() {
+				var sym = s.bindBlob(obj, face)
+				if s.blob(sym) == nil || sym.len() != face.len() {
+					b.Error("blob is not bound")
+					return
+				}
+				s.releaseBlobs(0)
+			}
+		})
+	})
+	b.Run("vocab", func(b *testing.B) {
+		var n atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				var sym = intern_ephemeral("blob." + strconv.FormatInt(n.Add(1), 36))
+				if sym.len() == 0 {
+					b.Error("ephemeral is not interned")
+					return
+				}
+				recycle_ephemeral(sym)
+			}
+		})
+	})
+}
+
+// BenchmarkBlobMatch matches a list of files from parallel workers, the
+// files are carried through the matcher as blobs.
+func BenchmarkBlobMatch(b *testing.B) {
+	var dir = b.TempDir()
+	var x = new_universe(workdir_sym(intern(dir)), []string{})
+	var files []Value
+	for _, s := range []string{"Makefile", "a.c", "b.c", "c.h"} {
+		var name = filepath.Join(dir, s)
+		if err := os.WriteFile(name, nil, 0644); err != nil { b.Fatal(err) }
+		files = append(files, _stat(main_ctx{x}, name))
+	}
+
+	var pat = _word(NoPos, intern("Makefile"))
+	var val = _list(files...)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if ok, res, _, _ := match(main_ctx{x}, pat, val); !ok || res != files[0] {
+				b.Errorf("%v: not matched: %v", pat, res)
+				return
+			}
+		}
+	})
+}
+
+// testDir writes the files into a temporary work directory.
+func testDir(t testing.TB, files map[string]string) string {
+	// not t.TempDir, whose numbered elements don't survive option parsing
+	var dir, err = os.MkdirTemp("", "smart-test-")
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for s, b := range files {
+		var name = filepath.Join(dir, s)
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil { t.Fatal(err) }
+		if err = os.WriteFile(name, []byte(b), 0644); err != nil { t.Fatal(err) }
+	}
+	return dir
+}
+
+// testRun loads and runs the work directory in a fresh universe with the
+// command line arguments and returns everything it printed (the results
+// of the goals are evaluated).
+func testRun(t testing.TB, dir string, args ...string) string {
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	var u = new_universe(workdir_sym(intern(dir)), args)
+	defer u.teardown()
+	func() {
+		defer func() {
+			if e := recover(); e != nil { fmt.Fprintf(&out, "panic: %v\n", e) }
+		}()
+		if u.load(main_ctx{u}); u.flush(u) > 0 { return }
+		for _, v := range u.run(main_ctx{u}) {
+			if v != nil { fmt.Fprintf(&out, "%s\n", __string(u, v)) }
+		}
+		u.flush(u)
+	}()
+	return out.String()
+}
+
+// testProject loads a project of the files in a temporary work directory
+// and returns a closure of its scope and a parser of expressions in it.
+func testProject(t testing.TB, files map[string]string) (c Context, parse func(string) Value) {
+	var dir = testDir(t, files)
+	var u = new_universe(workdir_sym(intern(dir)), []string{})
+	if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil {
+		t.Fatalf("%s: loading failed", dir)
+	}
+	var m = u.globe.main
+	c = closure_with(main_ctx{u}, m.scope)
+	return c, func(s string) Value {
+		var p = compiler{
+			symstr: &symstr{Context: &term{c, m.scope}},
+			compilestate: compilestate{project: m},
+		}
+		return p.text(m.absPath, s)
+	}
+}
+
+// TestPatterns matches the globs and percent patterns of file names, i.e.
+// qualwords like a.c, the stems of several dots take backtracking.
+func TestPatterns(t *testing.T) {
+	var c, parse = testProject(t, map[string]string{"do.smart": "project pattern\n"})
+	for _, x := range []struct{ pat, val string; ok bool; stem string }{
+		{"a.c", "a.c", true, ""},
+		{"a.c", "b.c", false, ""},
+		{"*.c", "a.c", true, "a"},
+		{"*.c", "a.b.c", true, "a.b"},
+		{"*.c", "do.smart", false, ""},
+		{"*.tar.gz", "a.b.tar.gz", true, "a.b"},
+		{"*.tar.gz", "a.tar.bz", false, ""},
+		{"%.c", "a.c", true, "a"},
+		{"%.c", "x.b.c", true, "x.b"},
+		{"%.o", "a.c", false, ""},
+	} {
+		var ok, _, _, stems = match(c, parse(x.pat), parse(x.val))
+		if ok != x.ok {
+			t.Errorf("%s ~ %s: matched=%v, want %v", x.pat, x.val, ok, x.ok)
+		} else if ok && x.stem != "" && (len(stems) != 1 || __string(c, stems[0]) != x.stem) {
+			t.Errorf("%s ~ %s: stems %v, want %s", x.pat, x.val, stems, x.stem)
+		}
+	}
+}
+
+// TestPatternBuiltins evaluates the builtins taking patterns of qualwords,
+// $(wildcard) looks into the project directory.
+func TestPatternBuiltins(t *testing.T) {
+	var c, parse = testProject(t, map[string]string{
+		"do.smart": "project pattern\nfiles (\n  *.c\n  *.h\n)\n",
+		"a.c": "", "b.c": "", "b.h": "",
+	})
+	for _, x := range []struct{ expr, want string }{
+		{"$(patsubst %.c,%.o,a.c x.b.c h.h)", "a.o x.b.o h.h"},
+		{"$(filter %.c,a.c b.h x.b.c)", "a.c x.b.c"},
+		{"$(filter-out %.c,a.c b.h x.b.c)", "b.h"},
+		{"$(wildcard *.c)", "a.c b.c"},
+		{"$(wildcard *.h)", "b.h"},
+	} {
+		var v = eval(c, parse(x.expr))
+		var got []string
+		for _, v := range merge(v) {
+			got = append(got, filepath.Base(__string(c, v)))
+		}
+		if s := strings.Join(got, " "); s != x.want {
+			t.Errorf("%s = %s, want %s", x.expr, s, x.want)
+		}
+	}
+}
+
+// TestDiagControls runs universes one after the other with and without the
+// warning controls, which must not leak into the next universe.
+func TestDiagControls(t *testing.T) {
+	var src, err = os.ReadFile(filepath.Join("testdata", "golden", "warn", "nowarn.smart"))
+	if err != nil { t.Fatal(err) }
+	var dir = testDir(t, map[string]string{"do.smart": string(src)})
+	for _, c := range []struct{ args []string; want, not string }{
+		{[]string{"-Werror"}, "error: deprecated (wait -stdout), use (shell -stdout) instead [-Werror,deprecated]", "warning:"},
+		{[]string{"-no-warn(deprecated)"}, "hello", "deprecated"},
+		{[]string{}, "warning: deprecated (wait -stdout), use (shell -stdout) instead [deprecated]", "-Werror"},
+	} {
+		var out = testRun(t, dir, c.args...)
+		if !strings.Contains(out, c.want) || strings.Contains(out, c.not) {
+			t.Errorf("%v: want %q, not %q in:\n%s", c.args, c.want, c.not, out)
+		}
+	}
+}
+
+// TestDiagFormat writes the diagnostics of a universe as JSON lines, the
+// next universe prints them as text again.
+func TestDiagFormat(t *testing.T) {
+	var src, err = os.ReadFile(filepath.Join("testdata", "golden", "warn", "nowarn.smart"))
+	if err != nil { t.Fatal(err) }
+	var dir = testDir(t, map[string]string{"do.smart": string(src)})
+	var report = filepath.Join(dir, "diag.json")
+
+	if out := testRun(t, dir, "-diag-format=json", "-diag-output="+report); strings.Contains(out, "warning:") {
+		t.Errorf("-diag-format=json: text diagnostics:\n%s", out)
+	}
+	if b, err := os.ReadFile(report); err != nil {
+		t.Fatal(err)
+	} else if s := string(b); !strings.Contains(s, `"level":"warning"`) || !strings.Contains(s, `[deprecated]"`) {
+		t.Errorf("-diag-output: no warning in:\n%s", s)
+	}
+
+	if out := testRun(t, dir); !strings.Contains(out, "warning: deprecated") {
+		t.Errorf("no text diagnostics after -diag-format=json:\n%s", out)
+	}
+}
+
+// TestClean removes the outputs recorded for -clean and the files stamped
+// for them, except the precious ones, the next universe starts with the
+// saved stamps and nothing to clean.
+func TestClean(t *testing.T) {
+	var dir = testDir(t, map[string]string{
+		"do.smart": "project clean\n\n.precious = b.txt\n",
+		"a.txt": "a\n", "b.txt": "b\n", "out/one.h": "1\n",
+	})
+	var name = func(s string) string { return filepath.Join(dir, s) }
+
+	var clean = func(args ...string) (u *universe) {
+		u = new_universe(workdir_sym(intern(dir)), args)
+		if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil {
+			t.Fatalf("%s: loading failed", dir)
+		}
+		var stamps = stampedPath(u)
+		t.Cleanup(func() { os.RemoveAll(filepath.Dir(stamps)) })
+		if _, err := os.Stat(stamps); err != nil {
+			if err = os.MkdirAll(filepath.Dir(stamps), 0755); err != nil { t.Fatal(err) }
+			if err = os.WriteFile(stamps, []byte(name("a.txt")+"\t"+name("out/one.h")+"\n"), 0644); err != nil { t.Fatal(err) }
+		}
+
+		// as cleanTarget records the targets of the rules
+		var m = u.globe.main
+		var ctx = closure_with(main_ctx{u}, m.scope)
+		var cleaning = &u.runs.cleaning
+		if len(cleaning.files) > 0 { t.Errorf("%v: cleaning %v", args, cleaning.files) }
+		cleaning.projs = make(map[*file]*project)
+		for _, s := range []string{"a.txt", "b.txt"} {
+			var f = _stat(ctx, intern(name(s)), stat_nonexist{true})
+			var files = []*file{f}
+			for _, s := range stampedFiles(ctx, f) { files = append(files, _stat(ctx, intern(s), stat_nonexist{true})) }
+			for _, f := range files {
+				cleaning.projs[f] = m
+				cleaning.files = append(cleaning.files, f)
+			}
+		}
+		if n := u.cleanOutputs(ctx); n > 0 { t.Errorf("%v: %d failed", args, n) }
+		return
+	}
+	var exists = func(s string) bool { _, err := os.Stat(name(s)); return err == nil }
+
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	clean("-clean", "-n").teardown()
+	if !exists("a.txt") || !exists("out/one.h") {
+		t.Errorf("-clean -n removed files")
+	} else if s := out.String(); !strings.Contains(s, name("a.txt")) || !strings.Contains(s, name("out/one.h")) || strings.Contains(s, name("b.txt")) {
+		t.Errorf("-clean -n listed:\n%s", s)
+	}
+
+	clean("-clean").teardown()
+	if exists("a.txt") || exists("out/one.h") {
+		t.Errorf("-clean kept a.txt or the stamped out/one.h")
+	} else if !exists("b.txt") {
+		t.Errorf("-clean removed the precious b.txt")
+	}
+
+	var u = new_universe(workdir_sym(intern(dir)), []string{})
+	defer u.teardown()
+	if u.load(main_ctx{u}); u.flush(u) > 0 { t.Fatalf("%s: loading failed", dir) }
+	if f := _stat(u, intern(name("a.txt")), stat_nonexist{true}); len(stampedFiles(u, f)) > 0 {
+		t.Errorf("stamps of the removed a.txt were saved: %v", stampedFiles(u, f))
+	} else if len(u.runs.cleaning.files) > 0 {
+		t.Errorf("cleaning leaked into the next universe: %v", u.runs.cleaning.files)
+	}
+}
+
+// TestIntermediates marks the targets of chained pattern rules with
+// -auto-intermediate and removes the ones made by the run, except the
+// precious, secondary and existing ones, the marks don't outlive the run.
+func TestIntermediates(t *testing.T) {
+	var dir = testDir(t, map[string]string{
+		"do.smart": "project chain\n\n.precious = keep.y\n",
+		"old.y": "old\n",
+	})
+	var name = func(s string) string { return filepath.Join(dir, s) }
+	var exists = func(s string) bool { _, err := os.Stat(name(s)); return err == nil }
+
+	var run = func(args ...string) (u *universe) {
+		u = new_universe(workdir_sym(intern(dir)), args)
+		if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil {
+			t.Fatalf("%s: loading failed", dir)
+		}
+		if n := len(u.runs.marks.files); n > 0 { t.Errorf("%v: %d marks before the run", args, n) }
+
+		// as traverse executes the stemmed rules of a.z: a.y: a.x
+		var m = u.globe.main
+		var ctx = closure_with(main_ctx{u}, m.scope)
+		var stemmed = func(c Context, s string) *execution {
+			var f = _stat(ctx, intern(name(s)), stat_nonexist{true})
+			var x = &execution{
+				Context: &stemmed_ctx{c, &stemmed_rule{stems: []Value{f}}},
+				scope: new_scope(c, m.scope, m, intern(s)),
+			}
+			x.set(x, defVoid, symAt, f)
+			return x
+		}
+		for _, s := range []string{"a", "keep", "old", "sec"} {
+			var x = stemmed(stemmed(ctx, s+".z"), s+".y")
+			x.chained()
+			if s == "sec" { markTargets(x, nil, markSecondary) }
+		}
+		for _, s := range []string{"a.y", "keep.y", "sec.y"} {
+			if err := os.WriteFile(name(s), []byte(s), 0644); err != nil { t.Fatal(err) }
+		}
+		u.removeIntermediates(ctx)
+		return
+	}
+
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	run().teardown()
+	if !exists("a.y") {
+		t.Errorf("a.y removed without -auto-intermediate")
+	} else if err := os.Remove(name("a.y")); err != nil {
+		t.Fatal(err)
+	}
+
+	var u = run("-auto-intermediate")
+	defer u.teardown()
+	if exists("a.y") {
+		t.Errorf("-auto-intermediate: a.y not removed")
+	}
+	for _, s := range []string{"keep.y", "old.y", "sec.y"} {
+		if !exists(s) { t.Errorf("-auto-intermediate: %s removed", s) }
+	}
+	if f := _stat(u, intern(name("a.z")), stat_nonexist{true}); targetMarked(u, f, markIntermediate) {
+		t.Errorf("-auto-intermediate: the goal a.z is marked")
+	}
+
+	// the next run of the universe starts without the marks
+	var keep = _stat(u, intern(name("keep.y")), stat_nonexist{true})
+	if !targetMarked(u, keep, markPrecious) {
+		t.Errorf("-auto-intermediate: keep.y is not marked precious")
+	} else if u.run(main_ctx{u}); targetMarked(u, keep, markIntermediate|markPrecious) {
+		t.Errorf("marks leaked into the next run")
+	}
+}
+
+// TestParallel traverses the prerequisites in the workers of -parallel,
+// `go test -race` checks the state they share.
+func TestParallel(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("project parallel\n\nall: one two three four {(shell)}\n\tcd \"$$SMART_TEST_DIR\" && touch all\n")
+	for _, s := range []string{"one:", "two:", "three:", "four: one"} {
+		var name, _, _ = strings.Cut(s, ":")
+		fmt.Fprintf(&src, "\n%s {(shell)}\n\tcd \"$$SMART_TEST_DIR\" && touch %s\n", s, name)
+	}
+	var dir = testDir(t, map[string]string{"do.smart": src.String()})
+	t.Setenv("SMART_TEST_DIR", dir)
+
+	for i := 0; i < 2; i++ {
+		testRun(t, dir, "-parallel")
+		for _, s := range []string{"one", "two", "three", "four", "all"} {
+			if err := os.Remove(filepath.Join(dir, s)); err != nil { t.Errorf("%d: %s not made: %v", i, s, err) }
+		}
+	}
+}
+
+// TestJobserver creates the jobserver of -jobs, passes it to the children
+// via MAKEFLAGS and joins it from another universe as make's children do.
+func TestJobserver(t *testing.T) {
+	var dir = testDir(t, map[string]string{"do.smart": "project jobs\n"})
+	var load = func(args ...string) (u *universe) {
+		u = new_universe(workdir_sym(intern(dir)), args)
+		if u.load(main_ctx{u}); u.flush(u) > 0 { t.Fatalf("%s: loading failed", dir) }
+		return
+	}
+
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+	t.Setenv("MAKEFLAGS", "")
+
+	var u = load("-jobs=2")
+	defer u.teardown()
+	var stop = startJobserver(u)
+	var fifo = u.jobserver.fifo
+	if fi, err := os.Stat(fifo); err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("-jobs=2: no fifo %q: %v\n%s", fifo, err, out.String())
+	} else if n := jobWorkers(u); n != 2 {
+		t.Errorf("-jobs=2: %d workers", n)
+	}
+
+	var c = exec.Command("true")
+	c.Env = []string{"MAKEFLAGS=-k --jobserver-auth=3,4"}
+	jobserverCmd(u, c)
+	if want := "MAKEFLAGS= -k -j2 --jobserver-auth=fifo:" + fifo; len(c.Env) != 1 || c.Env[0] != want {
+		t.Errorf("MAKEFLAGS: %q, want %q", c.Env, want)
+	}
+
+	// a child joins it, each one has an implicit slot and they share the token
+	t.Setenv("MAKEFLAGS", "-j2 --jobserver-auth=fifo:"+fifo)
+	var v = load()
+	defer v.teardown()
+	startJobserver(v)()
+	if v.jobserver.fifo != fifo || v.jobserver.owned {
+		t.Errorf("MAKEFLAGS: not joined (%q)", v.jobserver.fifo)
+	}
+	var held = []func(){acquireJob(u), acquireJob(v), acquireJob(v)}
+	var got = make(chan func())
+	go func() { got <- acquireJob(u) }()
+	select {
+	case <-got: t.Errorf("-jobs=2: a third job is running")
+	case <-time_pkg.After(50 * time_pkg.Millisecond):
+	}
+	held[2]()
+	held = append(held[:2], <-got)
+	for _, release := range held { release() }
+
+	stop()
+	if _, err := os.Stat(fifo); err == nil {
+		t.Errorf("%s: not removed", fifo)
+	}
+	t.Setenv("MAKEFLAGS", "")
+	var p = load("-jobs=3", "-jobserver-style=pipe")
+	defer p.teardown()
+	defer startJobserver(p)()
+	c = exec.Command("true")
+	c.Env = []string{}
+	if jobserverCmd(p, c); len(c.ExtraFiles) != 2 || len(c.Env) != 1 || c.Env[0] != "MAKEFLAGS= -j3 --jobserver-auth=3,4" {
+		t.Errorf("-jobserver-style=pipe: %q %v", c.Env, c.ExtraFiles)
+	}
+
+	var w = load()
+	defer w.teardown()
+	if startJobserver(w)(); w.jobserver.r != nil || jobWorkers(w) != maxWorkers {
+		t.Errorf("the jobserver leaked into the next universe")
+	}
+}
+
+// TestRepl reads the lines of -repl from the stdin of the universe, which
+// is not a terminal.
+func TestRepl(t *testing.T) {
+	var dir = testDir(t, map[string]string{"do.smart": "project repl\n\nfoo = x\n"})
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	var in = strings.NewReader("bar = $(foo) y\n$(bar) \\\n z\n:q\n$(foo)\n")
+	var u = new_universe(workdir_sym(intern(dir)), []string{"-repl"}, in)
+	defer u.teardown()
+	if u.load(main_ctx{u}); u.flush(u) > 0 { t.Fatalf("%s: loading failed", dir) }
+	u.repl(main_ctx{u})
+
+	if s := out.String(); !strings.Contains(s, "repl> repl> ... loc x\nloc y\nword z\nrepl> ") || strings.Count(s, "repl> ") != 3 {
+		t.Errorf("-repl:\n%s", s)
+	}
+}
+
+// TestFetch fetches http and file urls into the target, which is cached if
+// it matches the checksum, the .part file never remains.
+func TestFetch(t *testing.T) {
+	var hits atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/pkg.tar.gz" { http.NotFound(w, r); return }
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	const sum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" // hello\n
+
+	var dir = testDir(t, map[string]string{"do.smart": "project fetching\n", "local.txt": "local\n"})
+	var load = func(args ...string) (u *universe, c Context) {
+		u = new_universe(workdir_sym(intern(dir)), args)
+		t.Cleanup(u.teardown)
+		if u.load(main_ctx{u}); u.flush(u) > 0 || u.globe.main == nil { t.Fatalf("%s: loading failed", dir) }
+		c = closure_with(main_ctx{u}, u.globe.main.scope)
+		if _, s := u.globe.main.tempdir(c); strings.HasPrefix(s, filepath.Join(os.TempDir(), "smart")+"/") {
+			t.Cleanup(func() { os.RemoveAll(s) }) // the .fetch files
+		}
+		return
+	}
+	var out bytes.Buffer
+	defer redirect(&out, &out)()
+
+	var u, c = load()
+	var target = _stat(c, intern(filepath.Join(dir, "out", "pkg.tar.gz")), stat_nonexist{true})
+	var fetched = func(s string, checksum string, force bool) (content string, err error) {
+		var x, e = neturl.Parse(s)
+		if e != nil { t.Fatal(e) }
+		if err = fetch(c, x, target, checksum, force, false); err == nil {
+			var b []byte
+			b, err = os.ReadFile(target.fullname().String())
+			content = string(b)
+		}
+		if _, e := os.Stat(target.fullname().String() + ".part"); e == nil {
+			t.Errorf("%s: .part remains", s)
+		}
+		return
+	}
+
+	for _, x := range []struct{ url, sum string; force bool; want string; hits int32 }{
+		{srv.URL + "/pkg.tar.gz", "", false, "hello\n", 1},
+		{srv.URL + "/pkg.tar.gz", "sha256:" + sum, false, "hello\n", 1}, // cached
+		{srv.URL + "/pkg.tar.gz", sum, true, "hello\n", 2},
+		{srv.URL + "/pkg.tar.gz", strings.Repeat("0", 64), true, "checksum mismatched", 3},
+		{srv.URL + "/missing", "", true, "404 Not Found", 4},
+		{"file://" + filepath.ToSlash(filepath.Join(dir, "local.txt")), "", true, "local\n", 4},
+	} {
+		if s, err := fetched(x.url, x.sum, x.force); err != nil && !strings.Contains(err.Error(), x.want) || err == nil && s != x.want {
+			t.Errorf("%s: %q (%v), want %q", x.url, s, err, x.want)
+		} else if n := hits.Load(); n != x.hits {
+			t.Errorf("%s: %d requests, want %d", x.url, n, x.hits)
+		}
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	u.runctx = ctx
+	if _, err := fetched(srv.URL+"/pkg.tar.gz", "", true); err == nil || hits.Load() != 4 {
+		t.Errorf("canceled: fetched (%v)", err)
+	}
+	u.runctx = nil
+
+	// -n doesn't fetch, $(fetch) returns the file it would fetch
+	u, c = load("-n")
+	var p = compiler{symstr: &symstr{Context: &term{c, u.globe.main.scope}}, compilestate: compilestate{project: u.globe.main}}
+	var s = __string(c, p.text(u.globe.main.absPath, "$(fetch '"+srv.URL+"/new.tar.gz')"))
+	var _, name, _ = strings.Cut(strings.TrimSpace(out.String()), "# (fetch) "+srv.URL+"/new.tar.gz → ")
+	if !strings.HasSuffix(s, "new.tar.gz") || !strings.HasSuffix(name, "/"+s) {
+		t.Errorf("-n: $(fetch) = %q, printed %q", s, out.String())
+	} else if _, err := os.Stat(name); err == nil || hits.Load() != 4 {
+		t.Errorf("-n: fetched %s", name)
+	}
+}
+
+// TestArchive writes tar, tar.gz and zip archives of a tree with a symlink
+// like (archive) does and extracts them like (extract) does, with
+// -strip-components and the include/exclude patterns.
+func TestArchive(t *testing.T) {
+	var c, parse = testProject(t, map[string]string{
+		"do.smart": "project archive\n",
+		"src/a.c": "a.c\n", "src/a.h": "a.h\n", "src/test/t.c": "t.c\n",
+	})
+	var dir = _project(c).absPath.String()
+	if err := os.Symlink("a.h", filepath.Join(dir, "src", "b.h")); err != nil { t.Fatal(err) }
+
+	var names []string
+	var entries = make(map[string]string)
+	for _, s := range []string{"a.c", "a.h", "b.h", "test/t.c"} {
+		names = append(names, "foo-1.0/"+s) // -prefix=foo-1.0
+		entries["foo-1.0/"+s] = filepath.Join(dir, "src", filepath.FromSlash(s))
+	}
+	var mtime = reproducibleTime(c, "1700000000")
+
+	var write = func(format archiveformat) []byte {
+		var b bytes.Buffer
+		var err error
+		switch format {
+		case archiveTar: err = writeTar(&b, names, entries, mtime)
+		case archiveTarGz:
+			var zw = gzip.NewWriter(&b)
+			if err = writeTar(zw, names, entries, mtime); err == nil { err = zw.Close() }
+		case archiveZip: err = writeZip(&b, names, entries, mtime)
+		}
+		if err != nil { t.Fatal(err) }
+		return b.Bytes()
+	}
+	var patterns = func(s string) (a []Value) {
+		if s != "" { for _, p := range strings.Split(s, ",") { a = append(a, parse(p)) } }
+		return
+	}
+
+	for _, x := range []struct{ name string; format archiveformat }{
+		{"pkg.tar", archiveTar}, {"pkg.tar.gz", archiveTarGz}, {"pkg.zip", archiveZip},
+	} {
+		var b = write(x.format)
+		if !bytes.Equal(b, write(x.format)) {
+			t.Errorf("%s: not reproducible", x.name)
+		}
+		var filename = filepath.Join(dir, x.name)
+		if err := os.WriteFile(filename, b, 0644); err != nil { t.Fatal(err) }
+
+		for _, y := range []struct{ include, exclude string; want []string }{
+			{"", "", []string{"a.c", "a.h", "b.h", "test/t.c"}},
+			{"%.h", "", []string{"a.h", "b.h"}},
+			{"", "test,*.c", []string{"a.h", "b.h"}},
+			{"test/*", "", []string{"test/t.c"}},
+			{"", "a", []string{"a.c", "a.h", "b.h", "test/t.c"}}, // not a.c
+		} {
+			var ex = &extracted{dir: filepath.Join(dir, "out"), keep: true}
+			var filter = &archive_filter{c, 1, patterns(y.include), patterns(y.exclude)}
+			var err error
+			if x.format == archiveZip {
+				err = ex.unzip(filter, filename)
+			} else if r := io.Reader(bytes.NewReader(b)); x.format == archiveTar {
+				err = ex.untar(filter, r)
+			} else if r, err = gzip.NewReader(r); err == nil {
+				err = ex.untar(filter, r)
+			}
+			if err != nil { t.Fatalf("%s: %v", x.name, err) }
+
+			var got []string
+			for _, s := range ex.names {
+				var rel, _ = filepath.Rel(ex.dir, s)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(y.want) {
+				t.Errorf("%s -include=%s -exclude=%s: %v, want %v", x.name, y.include, y.exclude, got, y.want)
+			}
+			for _, s := range got {
+				var name = filepath.Join(ex.dir, filepath.FromSlash(s))
+				if s == "b.h" {
+					if link, err := os.Readlink(name); err != nil || link != "a.h" {
+						t.Errorf("%s: symlink %s -> %q (%v)", x.name, s, link, err)
+					}
+				} else if b, err := os.ReadFile(name); err != nil || string(b) != filepath.Base(s)+"\n" {
+					t.Errorf("%s: %s = %q (%v)", x.name, s, b, err)
+				} else if fi, _ := os.Stat(name); !fi.ModTime().Equal(mtime) {
+					t.Errorf("%s: %s mtime %v, want %v", x.name, s, fi.ModTime(), mtime)
+				}
+			}
+			if err := os.RemoveAll(ex.dir); err != nil { t.Fatal(err) }
+		}
+	}
+}
+
+// TestAutoconf translates testdata/autoconf/configure.ac into a configure
+// block and compares it against configure.golden, `go test -update`
+// rewrites it.
+func TestAutoconf(t *testing.T) {
+	var c, _ = testProject(t, map[string]string{"do.smart": "project autoconf\n"})
+	var src, err = os.ReadFile(filepath.Join("testdata", "autoconf", "configure.ac"))
+	if err != nil { t.Fatal(err) }
+
+	var out bytes.Buffer
+	if err = autoconf(c, &out, _project(c), string(src)); err != nil { t.Fatal(err) }
+
+	var filename = filepath.Join("testdata", "autoconf", "configure.golden")
+	if *update {
+		if err = os.WriteFile(filename, out.Bytes(), 0644); err != nil { t.Fatal(err) }
+	} else if b, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if want, got := string(b), out.String(); want != got {
+		t.Errorf("%s\n%s", filename, goldenDiff(want, got))
+	}
+}
+
+// TestSandboxTarget puts the existing target into a -sandbox scratch dir,
+// linked or copied if linking fails.
+func TestSandboxTarget(t *testing.T) {
+	var dir = t.TempDir()
+	var target = filepath.Join(dir, "lib.a")
+	if err := os.WriteFile(target, []byte("archive"), 0640); err != nil { t.Fatal(err) }
+	var mtime = time_pkg.Now().Add(-time_pkg.Hour).Truncate(time_pkg.Second)
+	if err := os.Chtimes(target, mtime, mtime); err != nil { t.Fatal(err) }
+
+	for _, exdev := range []bool{false, true} {
+		if exdev {
+			sandboxLink = func(oldname, newname string) error {
+				return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+			}
+			t.Cleanup(func() { sandboxLink = os.Link })
+		}
+		var scratch, err = os.MkdirTemp(dir, ".sandbox-")
+		if err != nil { t.Fatal(err) }
+		if err = sandboxTarget(scratch, target); err != nil {
+			t.Fatalf("exdev=%v: %v", exdev, err)
+		}
+		var s = filepath.Join(scratch, "lib.a")
+		var fi, _ = os.Stat(s)
+		var orig, _ = os.Stat(target)
+		if b, _ := os.ReadFile(s); string(b) != "archive" || fi == nil {
+			t.Errorf("exdev=%v: %q", exdev, b)
+		} else if fi.Mode() != orig.Mode() || !fi.ModTime().Equal(mtime) {
+			t.Errorf("exdev=%v: %v %v", exdev, fi.Mode(), fi.ModTime())
+		} else if os.SameFile(fi, orig) == exdev {
+			t.Errorf("exdev=%v: linked=%v", exdev, !exdev)
+		}
+		if err = sandboxTarget(scratch, filepath.Join(dir, "missing.a")); err != nil {
+			t.Errorf("exdev=%v: missing target: %v", exdev, err)
+		}
+	}
+}
+
+// TestTraceInputs parses the canned strace logs of testdata/strace (a
+// shell forking cc and as), the inputs are the files read but not written.
+func TestTraceInputs(t *testing.T) {
+	var dir = t.TempDir()
+	var logs, _ = filepath.Glob(filepath.Join("testdata", "strace", "trace.*"))
+	for _, s := range logs {
+		if b, err := os.ReadFile(s); err != nil {
+			t.Fatal(err)
+		} else if err = os.WriteFile(filepath.Join(dir, filepath.Base(s)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var inputs = traceInputs(filepath.Join(dir, "trace"), "/work")
+	var want = []string{
+		"/bin/sh", "/etc/ld.so.cache", // sh in /work
+		"/usr/bin/cc", "/work/src/a.c", "/work/src/a.h", "/work/include/b.h", "/work/include/c.h", // cc in src
+		"/work/lib/\"q\".h", "/usr/bin/as", "/work/lib/x.s", // fchdir to lib
+	}
+	if strings.Join(inputs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("inputs:\n%s\nwant:\n%s", strings.Join(inputs, "\n"), strings.Join(want, "\n"))
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "trace.*")); len(left) > 0 {
+		t.Errorf("logs are not removed: %v", left)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+import (
+	"os"
+	str "strings" // aliased
+)
+
+var usage = "usage: " +
+	"main [args]"
+
+func main() {
+	fmt.Println(usage, str.Join(os.Args, " "))
+}
@@ -0,0 +1,6 @@
+import os
+from . import b
+from .c import d
+from .. import top
+
+s = "from . import nothing"
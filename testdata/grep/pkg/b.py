@@ -0,0 +1 @@
+B = 1
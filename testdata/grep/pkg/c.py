@@ -0,0 +1 @@
+d = 1
@@ -0,0 +1,175 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	time_pkg "time"
+)
+
+// testUniverse creates and loads an embedded Universe of the files, its
+// standard output and diagnostics are captured in out and errs.
+func testUniverse(t *testing.T, files map[string]string, opts ...Option) (x *Universe, out, errs *bytes.Buffer) {
+	out, errs = new(bytes.Buffer), new(bytes.Buffer)
+	var dir = testDir(t, files)
+	x = New(append([]Option{WithWorkdir(dir), WithStdout(out), WithStderr(errs)}, opts...)...)
+	t.Cleanup(func() { x.Close() })
+	if err := x.Load(); err != nil { t.Fatalf("%s: %v\n%s", dir, err, errs) }
+	return
+}
+
+// TestUniverseEval lists the projects, rules and defs of a Universe and
+// evaluates expressions in its main project.
+func TestUniverseEval(t *testing.T) {
+	var x, _, _ = testUniverse(t, map[string]string{
+		"do.smart": "project api\n\nfoo = x\nbar = $(foo) y\n\nall:{(shell)}\n\ttrue\n",
+	})
+	if s := x.Projects(); len(s) == 0 || s[len(s)-1] != "api" {
+		t.Errorf("projects: %v", s)
+	}
+	if s := x.Rules(""); len(s) != 1 || s[0] != "all" {
+		t.Errorf("rules: %v", s)
+	}
+	if defs, err := x.Defs("api"); err != nil {
+		t.Error(err)
+	} else if defs["foo"] != "x" || defs["bar"] != "x y" {
+		t.Errorf("defs: %v", defs)
+	}
+	if _, err := x.Defs("nonexistent"); err == nil {
+		t.Errorf("defs of a nonexistent project")
+	}
+	for _, c := range []struct{ expr, want string }{
+		{"$(foo)", "x"},
+		{"$(bar) z", "x y z"},
+		{"$(patsubst %.c,%.o,a.c b.c)", "a.o b.o"},
+	} {
+		if s, err := x.Eval(c.expr); err != nil || s != c.want {
+			t.Errorf("eval %q: %q (%v), want %q", c.expr, s, err, c.want)
+		}
+	}
+}
+
+// TestUniverseRun runs goals and stops the commands of a canceled run.
+func TestUniverseRun(t *testing.T) {
+	var x, _, _ = testUniverse(t, map[string]string{
+		"do.smart": "project api\n\nhello:{(shell -stdout)}\n\techo hello\n\nslow:{(shell)}\n\tsleep 30\n",
+	})
+	if s, err := x.Run(context.Background(), "hello"); err != nil || len(s) != 1 || s[0] != "hello" {
+		t.Errorf("hello: %q (%v)", s, err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := x.Run(ctx, "hello"); err != context.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time_pkg.Millisecond)
+	defer cancel()
+	var start = time_pkg.Now()
+	if _, err := x.Run(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Errorf("slow: %v", err)
+	} else if d := time_pkg.Since(start); d > 10*time_pkg.Second {
+		t.Errorf("slow: stopped after %v", d)
+	}
+}
+
+// TestUniverseHooks intercepts the asserts, debug and error messages.
+func TestUniverseHooks(t *testing.T) {
+	var asserts, debugs, errors []string
+	var x, _, _ = testUniverse(t, map[string]string{"do.smart": "project api\n"}, WithHooks(Hooks{
+		Assert: func(pos Position, expr string, ok bool) bool {
+			if !ok { asserts = append(asserts, expr) }
+			return true
+		},
+		Debug: func(pos Position, msg string) { debugs = append(debugs, msg) },
+		Error: func(pos Position, msg string) { errors = append(errors, msg) },
+	}))
+	for _, s := range []string{"$(assert $(equal a,b))", "$(debug hello)", "$(error oops)"} {
+		if _, err := x.Eval(s); err != nil { t.Errorf("%s: %v", s, err) }
+	}
+	if len(asserts) != 1 || len(debugs) != 1 || debugs[0] != "hello" || len(errors) != 1 || errors[0] != "oops" {
+		t.Errorf("asserts %q, debugs %q, errors %q", asserts, debugs, errors)
+	}
+}
+
+// TestUniverses uses two universes one after the other, the arguments and
+// outputs of the first don't leak into the second.
+func TestUniverses(t *testing.T) {
+	var files = map[string]string{
+		"do.smart": "project api\n\nall:{(shell -stdout) (wait -stdout)}\n\techo hello\n",
+	}
+	var x, out1, errs1 = testUniverse(t, files, WithArgs("-Werror"))
+	if _, err := x.Run(context.Background()); err == nil {
+		t.Errorf("-Werror: no error")
+	} else if s := errs1.String(); !strings.Contains(s, "[-Werror,deprecated]") {
+		t.Errorf("-Werror: stderr %q", s)
+	}
+	x.Close()
+	var n1 = out1.Len() + errs1.Len()
+
+	var y, out2, errs2 = testUniverse(t, files, WithArgs("-n"))
+	if _, err := y.Run(context.Background()); err != nil {
+		t.Error(err)
+	} else if s := out2.String(); !strings.Contains(s, "echo hello") {
+		t.Errorf("-n: stdout %q", s)
+	} else if s = errs2.String(); !strings.Contains(s, "warning: deprecated") || strings.Contains(s, "-Werror") {
+		t.Errorf("-n: stderr %q", s)
+	}
+	if n := out1.Len() + errs1.Len(); n != n1 {
+		t.Errorf("the second universe wrote to the first: %q %q", out1, errs1)
+	}
+}
+
+// TestDryModifiers runs the modifiers which write files with -n, which
+// prints what they would do, and with -no-exec, which is quiet, neither
+// writes a file.
+func TestDryModifiers(t *testing.T) {
+	var files = map[string]string{
+		"do.smart": "project dry\n\n" +
+			"write:{(write-file out/w.txt)}\n\thello\n\n" +
+			"download:{(download 'http://127.0.0.1:1/x.tar.gz' out/x.tar.gz)}\n\n" +
+			"extract:{(extract src.tar out)}\n\n" +
+			"archive:{(archive src)}\n\n" +
+			"conf:{(extract-configuration -target=out/config.h)}\n",
+		"src/a.c": "#ifdef HAVE_FOO\n#endif\n",
+		"src.tar": "not a tar",
+	}
+	var goals = []string{"write", "download", "extract", "archive", "conf"}
+	var written = func(x *Universe) (a []string) {
+		a, _ = filepath.Glob(filepath.Join(x.workdir, "out", "*"))
+		if _, err := os.Stat(filepath.Join(x.workdir, "archive")); err == nil { a = append(a, "archive") }
+		return
+	}
+
+	var x, out, errs = testUniverse(t, files, WithArgs("-n"))
+	if _, err := x.Run(context.Background(), goals...); err != nil {
+		t.Fatalf("-n: %v\n%s", err, errs)
+	}
+	for _, s := range []string{
+		"# (write-file) out/w.txt\n",
+		"# (download) 'http://127.0.0.1:1/x.tar.gz' → " + filepath.Join(x.workdir, "out/x.tar.gz") + "\n",
+		"# (extract) src.tar → " + filepath.Join(x.workdir, "out") + "\n",
+		"# (archive) [src] → archive\n",
+		"# (extract-configuration) ",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("-n: no %q in\n%s", s, out)
+		}
+	}
+	if a := written(x); len(a) > 0 {
+		t.Errorf("-n: written %v", a)
+	}
+
+	var y, out2, errs2 = testUniverse(t, files, WithArgs("-no-exec"))
+	if _, err := y.Run(context.Background(), goals...); err != nil {
+		t.Fatalf("-no-exec: %v\n%s", err, errs2)
+	} else if strings.Contains(out2.String(), "# (") {
+		t.Errorf("-no-exec: printed\n%s", out2)
+	} else if a := written(y); len(a) > 0 {
+		t.Errorf("-no-exec: written %v", a)
+	}
+}